@@ -4,24 +4,39 @@ Copyright © 2026 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/bootstrap"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/consumer"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/consumer/handlers"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/messaging"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/persistence"
-	"github.com/nats-io/nats.go"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/lifecycle"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var (
+	consumerHandlers      []string
+	consumerAllowRecreate bool
+	consumerStartSeq      uint64
+	consumerStartTime     string
+)
+
 var consumerCmd = &cobra.Command{
 	Use:   "consumer",
-	Short: "Run a JetStream consumer for user.created events",
+	Short: "Run JetStream consumers for the configured durables",
+	Long: `Runs every durable declared in nats.consumers whose handlers include at least one
+of the selected handlers. Without --handlers all registered handlers are selected.
+
+Durable config changes are applied in place. Changes the server cannot update
+need --allow-recreate together with --start-seq or --start-time.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		cfg, err := config.Load(cfgFile)
 		if err != nil {
@@ -34,7 +49,7 @@ var consumerCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		client, err := messaging.NewNATS(cmd.Context(), cfg.NATS)
+		client, err := messaging.NewNATS(cmd.Context(), cfg.NATS, log)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "nats error:", err)
 			os.Exit(1)
@@ -45,12 +60,6 @@ var consumerCmd = &cobra.Command{
 		}
 		defer client.Close()
 
-		js := client.JetStream()
-		if js == nil {
-			fmt.Fprintln(os.Stderr, "nats error: jetstream not initialized")
-			os.Exit(1)
-		}
-
 		db, err := persistence.New(cmd.Context(), persistence.Config{
 			WriteDSN:          cfg.Database.WriteDSN,
 			ReadDSN:           cfg.Database.ReadDSN,
@@ -65,160 +74,85 @@ var consumerCmd = &cobra.Command{
 			os.Exit(1)
 		}
 		defer db.Close()
-		auditRepo := persistence.NewAuditLogRepository(db)
 
-		if err := ensureConsumer(cmd.Context(), cfg, js); err != nil {
-			fmt.Fprintln(os.Stderr, "consumer config error:", err)
-			os.Exit(1)
+		reconcile := messaging.ReconcileOptions{
+			AllowRecreate: consumerAllowRecreate,
+			StartSequence: consumerStartSeq,
 		}
-
-		log.Infof("consumer: listening on %s (durable=%s)", cfg.NATS.UserCreatedSubject, cfg.NATS.ConsumerDurable)
-		sub, err := js.PullSubscribe(
-			cfg.NATS.UserCreatedSubject,
-			cfg.NATS.ConsumerDurable,
-			nats.Bind(cfg.NATS.Stream, cfg.NATS.ConsumerDurable),
-		)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "subscribe error:", err)
-			os.Exit(1)
-		}
-
-		for {
-			select {
-			case <-cmd.Context().Done():
-				return
-			default:
-			}
-
-			msgs, err := sub.Fetch(50, nats.MaxWait(2*time.Second))
+		if consumerStartTime != "" {
+			reconcile.StartTime, err = time.Parse(time.RFC3339, consumerStartTime)
 			if err != nil {
-				if errors.Is(err, nats.ErrTimeout) {
-					continue
-				}
-				log.WithError(err).Warn("consumer: fetch failed")
-				continue
-			}
-			for _, msg := range msgs {
-				if err := auditRepo.Create(cmd.Context(), msg.Subject, msg.Data); err != nil {
-					log.WithError(err).Warn("consumer: audit log insert failed")
-					handleConsumerError(cmd.Context(), cfg, client, msg, log)
-					continue
-				}
-				log.Infof("user.created: %s", string(msg.Data))
-				_ = msg.Ack()
+				fmt.Fprintln(os.Stderr, "consumer config error: --start-time:", err)
+				os.Exit(1)
 			}
 		}
-	},
-}
+		subscriber := messaging.NewJetStreamSubscriber(client.JetStream(), cfg.NATS.Stream, reconcile, log)
 
-func init() {
-	rootCmd.AddCommand(consumerCmd)
+		shutdown := lifecycle.Listen(cmd.Context(), cfg.Shutdown.GracePeriod)
+		defer shutdown.Close()
+		if err := runConsumers(shutdown, cfg, db, subscriber, client, consumerHandlers, log); err != nil {
+			fmt.Fprintln(os.Stderr, "consumer error:", err)
+			os.Exit(1)
+		}
+	},
 }
 
-func ensureConsumer(ctx context.Context, cfg config.Config, js nats.JetStreamContext) error {
-	if cfg.NATS.Stream == "" {
-		return errors.New("nats stream is required")
-	}
-	if cfg.NATS.ConsumerDurable == "" {
-		return errors.New("nats consumer durable is required")
-	}
-	if cfg.NATS.UserCreatedSubject == "" {
-		return errors.New("nats user created subject is required")
-	}
-
-	info, err := js.ConsumerInfo(cfg.NATS.Stream, cfg.NATS.ConsumerDurable, nats.Context(ctx))
-	if err != nil && !errors.Is(err, nats.ErrConsumerNotFound) {
+// runConsumers runs every configured durable that uses one of the selected
+// handlers until shutdown. A durable that fails to start stops the others
+// so the process exits and gets restarted instead of running half of its
+// consumers.
+func runConsumers(shutdown *lifecycle.Shutdown, cfg config.Config, db *persistence.DB, subscriber broker.Subscriber, publisher broker.Publisher, selected []string, log *logrus.Logger) error {
+	registry := consumer.NewRegistry()
+	handlers.Register(registry, db)
+	registry, err := registry.Select(selected)
+	if err != nil {
 		return err
 	}
 
-	backoff := cfg.NATS.ConsumerBackoff
-	maxDeliver := cfg.NATS.ConsumerMaxDeliver
-	if maxDeliver <= 0 {
-		maxDeliver = -1
-	}
-
-	if info != nil {
-		if info.Config.MaxDeliver != maxDeliver || !sameBackoff(info.Config.BackOff, backoff) {
-			if err := js.DeleteConsumer(cfg.NATS.Stream, cfg.NATS.ConsumerDurable, nats.Context(ctx)); err != nil {
-				return err
-			}
-			info = nil
-		}
+	verifier, err := messaging.NewVerifier(cfg.NATS.Signing)
+	if err != nil {
+		return err
 	}
 
-	if info == nil {
-		consumerCfg := &nats.ConsumerConfig{
-			Durable:       cfg.NATS.ConsumerDurable,
-			AckPolicy:     nats.AckExplicitPolicy,
-			AckWait:       cfg.NATS.AckWait,
-			MaxAckPending: cfg.NATS.MaxAckPending,
-			MaxDeliver:    maxDeliver,
-			FilterSubject: cfg.NATS.UserCreatedSubject,
-		}
-		if len(backoff) > 0 {
-			consumerCfg.BackOff = backoff
+	inbox := persistence.NewInboxRepository(db)
+	var runtimes []*consumer.Runtime
+	for _, c := range cfg.NATS.Consumers {
+		rt := consumer.NewRuntime(subscriber, publisher, inbox, c, registry, log)
+		rt.VerifySignatures(verifier)
+		if rt.Enabled() {
+			runtimes = append(runtimes, rt)
 		}
-		if _, err := js.AddConsumer(cfg.NATS.Stream, consumerCfg, nats.Context(ctx)); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func sameBackoff(a, b []time.Duration) bool {
-	if len(a) != len(b) {
-		return false
 	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
-		}
+	if len(runtimes) == 0 {
+		return errors.New("no configured durable uses the selected handlers")
 	}
-	return true
-}
 
-func handleConsumerError(ctx context.Context, cfg config.Config, client *messaging.NATSClient, msg *nats.Msg, log *logrus.Logger) {
-	md, err := msg.Metadata()
-	if err != nil {
-		log.WithError(err).Warn("consumer: metadata missing")
-		_ = msg.Nak()
-		return
-	}
-	maxDeliver := cfg.NATS.ConsumerMaxDeliver
-	if maxDeliver <= 0 {
-		maxDeliver = 10
-	}
-	if int(md.NumDelivered) >= maxDeliver {
-		if cfg.NATS.DLQSubject != "" {
-			if err := client.Publish(ctx, cfg.NATS.DLQSubject, msg.Data, fmt.Sprintf("dlq-%d", md.Sequence.Stream)); err != nil {
-				log.WithError(err).Warn("consumer: dlq publish failed")
-				_ = msg.Nak()
-				return
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(runtimes))
+	for _, rt := range runtimes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := rt.Run(shutdown.Stopping(), shutdown.Work()); err != nil {
+				errCh <- err
+				shutdown.Stop()
 			}
-		} else {
-			log.Warn("consumer: dlq subject not configured")
-		}
-		_ = msg.Ack()
-		return
+		}()
 	}
-	delay := backoffForAttempt(cfg.NATS.ConsumerBackoff, md.NumDelivered)
-	if delay > 0 {
-		_ = msg.NakWithDelay(delay)
-		return
+	wg.Wait()
+	close(errCh)
+	var errs []error
+	for err := range errCh {
+		log.WithError(err).Error("consumer: stopped")
+		errs = append(errs, err)
 	}
-	_ = msg.Nak()
+	return errors.Join(errs...)
 }
 
-func backoffForAttempt(backoff []time.Duration, delivered uint64) time.Duration {
-	if len(backoff) == 0 {
-		return 0
-	}
-	idx := int(delivered) - 1
-	if idx < 0 {
-		idx = 0
-	}
-	if idx >= len(backoff) {
-		idx = len(backoff) - 1
-	}
-	return backoff[idx]
+func init() {
+	consumerCmd.Flags().StringSliceVar(&consumerHandlers, "handlers", nil, "handlers to run (default: all registered)")
+	consumerCmd.Flags().BoolVar(&consumerAllowRecreate, "allow-recreate", false, "recreate durables whose config cannot be updated in place")
+	consumerCmd.Flags().Uint64Var(&consumerStartSeq, "start-seq", 0, "stream sequence a recreated durable starts from")
+	consumerCmd.Flags().StringVar(&consumerStartTime, "start-time", "", "time (RFC 3339) a recreated durable starts from")
+	rootCmd.AddCommand(consumerCmd)
 }
@@ -0,0 +1,107 @@
+/*
+Copyright © 2026 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/bootstrap"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/messaging"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/persistence"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/lifecycle"
+	"github.com/spf13/cobra"
+)
+
+var devHandlers []string
+
+var devCmd = &cobra.Command{
+	Use:   "dev",
+	Short: "Run the API, outbox worker and consumers in one process",
+	Long: `Runs the API server, the outbox worker and the consumers together on an
+in-memory broker, so only Postgres is needed. Streams, durables and the DLQ
+live in process and are lost on exit; events not yet consumed are published
+again only if their outbox rows are still pending.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "config error:", err)
+			os.Exit(1)
+		}
+		log, err := bootstrap.BuildLogger(cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "log error:", err)
+			os.Exit(1)
+		}
+
+		db, err := persistence.New(cmd.Context(), persistence.Config{
+			WriteDSN:          cfg.Database.WriteDSN,
+			ReadDSN:           cfg.Database.ReadDSN,
+			MaxConns:          cfg.Database.MaxConns,
+			MinConns:          cfg.Database.MinConns,
+			MaxConnLifetime:   cfg.Database.MaxConnLifetime,
+			MaxConnIdleTime:   cfg.Database.MaxConnIdleTime,
+			HealthCheckPeriod: cfg.Database.HealthCheckPeriod,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "db error:", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		streams, err := messaging.DesiredStreams(cfg.NATS)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "config error:", err)
+			os.Exit(1)
+		}
+		mem := messaging.NewMemoryBroker()
+		for _, s := range streams {
+			mem.AddStream(s.Name, s.Subjects)
+		}
+
+		shutdown := lifecycle.Listen(cmd.Context(), cfg.Shutdown.GracePeriod)
+		defer shutdown.Close()
+
+		var (
+			wg   sync.WaitGroup
+			mu   sync.Mutex
+			errs []error
+		)
+		run := func(name string, fn func() error) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := fn(); err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("%s: %w", name, err))
+					mu.Unlock()
+					shutdown.Stop()
+				}
+			}()
+		}
+		run("server", func() error {
+			return bootstrap.Serve(shutdown.Stopping(), cfg, bootstrap.ServerOptions{DB: db, Publisher: mem}, log)
+		})
+		run("outbox-worker", func() error {
+			return runOutboxWorker(shutdown, cfg, db, mem, log)
+		})
+		run("consumer", func() error {
+			return runConsumers(shutdown, cfg, db, mem.Subscriber(cfg.NATS.Stream), mem, devHandlers, log)
+		})
+		wg.Wait()
+
+		if err := errors.Join(errs...); err != nil {
+			fmt.Fprintln(os.Stderr, "dev error:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	devCmd.Flags().StringSliceVar(&devHandlers, "handlers", nil, "consumer handlers to run (default: all registered)")
+	rootCmd.AddCommand(devCmd)
+}
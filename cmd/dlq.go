@@ -0,0 +1,290 @@
+/*
+Copyright © 2026 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/bootstrap"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/messaging"
+	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
+)
+
+var (
+	dlqSubject    string
+	dlqSince      string
+	dlqUntil      string
+	dlqError      string
+	dlqSeqs       []uint
+	dlqLimit      int
+	dlqDryRun     bool
+	dlqRate       float64
+	dlqMaxReplays int
+	dlqDelete     bool
+	dlqAll        bool
+)
+
+var dlqCmd = &cobra.Command{
+	Use:   "dlq",
+	Short: "Inspect, replay and purge dead-lettered messages",
+}
+
+var dlqListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List DLQ entries",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, store := openDLQ(cmd.Context())
+		defer client.Close()
+
+		filter := dlqFilter()
+		filter.Limit = dlqLimit
+		entries, err := store.List(cmd.Context(), filter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "dlq error:", err)
+			os.Exit(1)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SEQ\tFAILED_AT\tSUBJECT\tCONSUMER\tDELIVERED\tREPLAYS\tREASON\tERROR")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+				e.Sequence, e.FailedAt().UTC().Format(time.RFC3339), e.DeadLetter.Subject, e.DeadLetter.Consumer,
+				e.DeadLetter.Delivered, e.ReplayCount(), e.DeadLetter.Reason, truncate(e.DeadLetter.Error, 80))
+		}
+		_ = w.Flush()
+	},
+}
+
+var dlqShowCmd = &cobra.Command{
+	Use:   "show <seq>",
+	Short: "Print one DLQ entry with its headers and payload",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		seq, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "dlq error: invalid sequence:", args[0])
+			os.Exit(1)
+		}
+		client, store := openDLQ(cmd.Context())
+		defer client.Close()
+
+		e, err := store.Get(cmd.Context(), seq)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "dlq error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Sequence: %d\nSubject:  %s\nStored:   %s\n\nHeaders:\n", e.Sequence, e.Subject, e.StoredAt.UTC().Format(time.RFC3339Nano))
+		keys := make([]string, 0, len(e.Headers))
+		for k := range e.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("  %s: %s\n", k, e.Headers[k])
+		}
+		fmt.Println("\nPayload:")
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, e.Data, "  ", "  ") == nil {
+			fmt.Println("  " + pretty.String())
+		} else {
+			fmt.Println("  " + string(e.Data))
+		}
+	},
+}
+
+var dlqReplayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Republish DLQ entries to their original subject",
+	Long: `Republishes the selected entries to the subject they were dead-lettered from.
+Replayed messages carry X-DLQ-Replay-Count; entries that already reached
+--max-replays are skipped so a message that keeps failing cannot loop.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !dlqHasSelector() {
+			fmt.Fprintln(os.Stderr, "dlq error: select entries with --seq, --subject, --since, --until, --error or --all")
+			os.Exit(1)
+		}
+		client, store := openDLQ(cmd.Context())
+		defer client.Close()
+
+		entries, err := store.List(cmd.Context(), dlqFilter())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "dlq error:", err)
+			os.Exit(1)
+		}
+		var limiter *rate.Limiter
+		if dlqRate > 0 {
+			limiter = rate.NewLimiter(rate.Limit(dlqRate), 1)
+		}
+
+		replayed, skipped := 0, 0
+		for _, e := range entries {
+			if dlqDryRun {
+				fmt.Printf("would replay %d -> %s (replays=%d)\n", e.Sequence, e.DeadLetter.Subject, e.ReplayCount())
+				continue
+			}
+			if limiter != nil {
+				if err := limiter.Wait(cmd.Context()); err != nil {
+					break
+				}
+			}
+			if err := store.Replay(cmd.Context(), client, e, dlqMaxReplays); err != nil {
+				if errors.Is(err, messaging.ErrReplayLimit) || errors.Is(err, messaging.ErrNoOriginSubject) {
+					fmt.Fprintf(os.Stderr, "skip %d: %v\n", e.Sequence, err)
+					skipped++
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "dlq error: replay %d: %v\n", e.Sequence, err)
+				os.Exit(1)
+			}
+			replayed++
+			if dlqDelete {
+				if err := store.Delete(cmd.Context(), e.Sequence); err != nil {
+					fmt.Fprintf(os.Stderr, "dlq error: delete %d: %v\n", e.Sequence, err)
+					os.Exit(1)
+				}
+			}
+		}
+		if dlqDryRun {
+			fmt.Printf("%d entries selected (dry run)\n", len(entries))
+			return
+		}
+		fmt.Printf("replayed %d, skipped %d\n", replayed, skipped)
+	},
+}
+
+var dlqPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete DLQ entries",
+	Run: func(cmd *cobra.Command, args []string) {
+		if !dlqHasSelector() {
+			fmt.Fprintln(os.Stderr, "dlq error: select entries with --seq, --subject, --since, --until, --error or --all")
+			os.Exit(1)
+		}
+		client, store := openDLQ(cmd.Context())
+		defer client.Close()
+
+		entries, err := store.List(cmd.Context(), dlqFilter())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "dlq error:", err)
+			os.Exit(1)
+		}
+		for _, e := range entries {
+			if dlqDryRun {
+				fmt.Printf("would delete %d (%s)\n", e.Sequence, e.DeadLetter.Subject)
+				continue
+			}
+			if err := store.Delete(cmd.Context(), e.Sequence); err != nil {
+				fmt.Fprintf(os.Stderr, "dlq error: delete %d: %v\n", e.Sequence, err)
+				os.Exit(1)
+			}
+		}
+		if dlqDryRun {
+			fmt.Printf("%d entries selected (dry run)\n", len(entries))
+			return
+		}
+		fmt.Printf("deleted %d entries\n", len(entries))
+	},
+}
+
+// openDLQ only dials NATS: reading or replaying the DLQ must never create or
+// update streams.
+func openDLQ(ctx context.Context) (*messaging.NATSClient, *messaging.DLQStore) {
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config error:", err)
+		os.Exit(1)
+	}
+	log, err := bootstrap.BuildLogger(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "log error:", err)
+		os.Exit(1)
+	}
+	client, err := messaging.Dial(ctx, cfg.NATS, log)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "nats error:", err)
+		os.Exit(1)
+	}
+	if client == nil {
+		fmt.Fprintln(os.Stderr, "nats error: nats url is required")
+		os.Exit(1)
+	}
+	return client, messaging.NewDLQStore(client.JetStream(), messaging.DLQStream(cfg.NATS), messaging.DLQSubjects(cfg.NATS))
+}
+
+func dlqFilter() messaging.DLQFilter {
+	since, err := parseTimeFlag(dlqSince)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dlq error: --since:", err)
+		os.Exit(1)
+	}
+	until, err := parseTimeFlag(dlqUntil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dlq error: --until:", err)
+		os.Exit(1)
+	}
+	sequences := make([]uint64, 0, len(dlqSeqs))
+	for _, seq := range dlqSeqs {
+		sequences = append(sequences, uint64(seq))
+	}
+	return messaging.DLQFilter{
+		Sequences: sequences,
+		Subject:   dlqSubject,
+		Since:     since,
+		Until:     until,
+		Error:     dlqError,
+	}
+}
+
+func dlqHasSelector() bool {
+	return dlqAll || len(dlqSeqs) > 0 || dlqSubject != "" || dlqSince != "" || dlqUntil != "" || dlqError != ""
+}
+
+// parseTimeFlag accepts an RFC 3339 time or a duration meaning that long ago.
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
+
+func init() {
+	for _, c := range []*cobra.Command{dlqListCmd, dlqReplayCmd, dlqPurgeCmd} {
+		c.Flags().StringVar(&dlqSubject, "subject", "", "original subject (wildcards allowed)")
+		c.Flags().StringVar(&dlqSince, "since", "", "failed at or after (RFC 3339 or duration ago, e.g. 24h)")
+		c.Flags().StringVar(&dlqUntil, "until", "", "failed at or before (RFC 3339 or duration ago)")
+		c.Flags().StringVar(&dlqError, "error", "", "error message contains (case-insensitive)")
+		c.Flags().UintSliceVar(&dlqSeqs, "seq", nil, "DLQ stream sequences")
+	}
+	dlqListCmd.Flags().IntVar(&dlqLimit, "limit", 100, "maximum entries to list (0 for all)")
+	for _, c := range []*cobra.Command{dlqReplayCmd, dlqPurgeCmd} {
+		c.Flags().BoolVar(&dlqDryRun, "dry-run", false, "print the selected entries without changing anything")
+		c.Flags().BoolVar(&dlqAll, "all", false, "select every entry")
+	}
+	dlqReplayCmd.Flags().Float64Var(&dlqRate, "rate", 10, "messages per second (0 for unlimited)")
+	dlqReplayCmd.Flags().IntVar(&dlqMaxReplays, "max-replays", 3, "skip entries replayed this many times (0 to disable)")
+	dlqReplayCmd.Flags().BoolVar(&dlqDelete, "delete", false, "delete entries from the DLQ once replayed")
+
+	dlqCmd.AddCommand(dlqListCmd, dlqShowCmd, dlqReplayCmd, dlqPurgeCmd)
+	rootCmd.AddCommand(dlqCmd)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright © 2026 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/events"
+	"github.com/spf13/cobra"
+)
+
+var (
+	eventsSchemaDir   string
+	eventsSchemaWrite bool
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Inspect the versioned event contracts",
+}
+
+var eventsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List registered event types and versions",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, d := range events.All() {
+			fmt.Printf("%s\t%T\n", d.Name(), d.Payload)
+		}
+	},
+}
+
+var eventsSchemasCmd = &cobra.Command{
+	Use:   "schemas",
+	Short: "Check the committed JSON Schemas against the event types",
+	Long: `Generates the JSON Schema of every registered event and compares it with
+the committed copy in --dir. Any difference, or an old version without an
+upcaster, exits non-zero, so accidental contract changes fail CI. Run with
+--write after an intended change.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		want := map[string][]byte{}
+		for _, d := range events.All() {
+			schema, _ := events.SchemaFor(d.Type, d.Version)
+			data, err := schema.JSON()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "schema error:", err)
+				os.Exit(1)
+			}
+			want[d.Name()+".json"] = data
+		}
+
+		if eventsSchemaWrite {
+			if err := os.MkdirAll(eventsSchemaDir, 0o755); err != nil {
+				fmt.Fprintln(os.Stderr, "schema error:", err)
+				os.Exit(1)
+			}
+			for name, data := range want {
+				if err := os.WriteFile(filepath.Join(eventsSchemaDir, name), data, 0o644); err != nil {
+					fmt.Fprintln(os.Stderr, "schema error:", err)
+					os.Exit(1)
+				}
+			}
+			fmt.Printf("wrote %d schemas to %s\n", len(want), eventsSchemaDir)
+			return
+		}
+
+		var problems []string
+		for name, data := range want {
+			got, err := os.ReadFile(filepath.Join(eventsSchemaDir, name))
+			switch {
+			case os.IsNotExist(err):
+				problems = append(problems, name+": missing")
+			case err != nil:
+				problems = append(problems, name+": "+err.Error())
+			case !bytes.Equal(got, data):
+				problems = append(problems, name+": differs from the event type")
+			}
+		}
+		files, _ := filepath.Glob(filepath.Join(eventsSchemaDir, "*.json"))
+		for _, f := range files {
+			if _, ok := want[filepath.Base(f)]; !ok {
+				problems = append(problems, filepath.Base(f)+": no registered event")
+			}
+		}
+		for _, name := range events.CheckUpcasters() {
+			problems = append(problems, name+": no upcaster to the next version")
+		}
+		if len(problems) > 0 {
+			sort.Strings(problems)
+			fmt.Fprintln(os.Stderr, "schema error: event contracts changed:\n  "+strings.Join(problems, "\n  "))
+			fmt.Fprintln(os.Stderr, "add a new event version for breaking changes, then run `events schemas --write`")
+			os.Exit(1)
+		}
+		fmt.Printf("%d schemas up to date\n", len(want))
+	},
+}
+
+func init() {
+	eventsSchemasCmd.Flags().StringVar(&eventsSchemaDir, "dir", "schemas/events", "directory holding the committed schemas")
+	eventsSchemasCmd.Flags().BoolVar(&eventsSchemaWrite, "write", false, "regenerate the committed schemas")
+	eventsCmd.AddCommand(eventsListCmd, eventsSchemasCmd)
+	rootCmd.AddCommand(eventsCmd)
+}
@@ -0,0 +1,38 @@
+/*
+Copyright © 2026 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/bootstrap"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var inboxMaintenanceDryRun bool
+
+var inboxMaintenanceCmd = &cobra.Command{
+	Use:   "inbox-maintenance",
+	Short: "Prune old consumer inbox entries",
+	Long: `Deletes consumer_inbox rows processed more than nats.inbox_retention ago.
+A zero retention keeps every row.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "config error:", err)
+			os.Exit(1)
+		}
+		if err := bootstrap.MaintainInbox(cmd.Context(), cfg, inboxMaintenanceDryRun); err != nil {
+			fmt.Fprintln(os.Stderr, "inbox maintenance error:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	inboxMaintenanceCmd.Flags().BoolVar(&inboxMaintenanceDryRun, "dry-run", false, "print the cutoff without deleting")
+	rootCmd.AddCommand(inboxMaintenanceCmd)
+}
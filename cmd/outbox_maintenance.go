@@ -0,0 +1,39 @@
+/*
+Copyright © 2026 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/bootstrap"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var maintenanceDryRun bool
+
+var outboxMaintenanceCmd = &cobra.Command{
+	Use:   "outbox-maintenance",
+	Short: "Create upcoming outbox partitions and expire old ones",
+	Long: `Creates daily outbox_events partitions for the next outbox.partition_premake days
+and drops (or moves into outbox.archive_schema) partitions older than
+outbox.retention. Unprocessed and dead events are always kept.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "config error:", err)
+			os.Exit(1)
+		}
+		if err := bootstrap.MaintainOutbox(cmd.Context(), cfg, maintenanceDryRun); err != nil {
+			fmt.Fprintln(os.Stderr, "outbox maintenance error:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	outboxMaintenanceCmd.Flags().BoolVar(&maintenanceDryRun, "dry-run", false, "print planned changes without applying them")
+	rootCmd.AddCommand(outboxMaintenanceCmd)
+}
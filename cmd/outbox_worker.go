@@ -5,16 +5,23 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
 
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/bootstrap"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/coordination"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/messaging"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/persistence"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/lifecycle"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
 )
 
 var outboxCmd = &cobra.Command{
@@ -47,7 +54,7 @@ var outboxCmd = &cobra.Command{
 		}
 		defer db.Close()
 
-		natsClient, err := messaging.NewNATS(cmd.Context(), cfg.NATS)
+		natsClient, err := messaging.NewNATS(cmd.Context(), cfg.NATS, log)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "nats error:", err)
 			os.Exit(1)
@@ -58,48 +65,233 @@ var outboxCmd = &cobra.Command{
 		}
 		defer natsClient.Close()
 
-		repo := persistence.NewOutboxRepository(db)
-		log.Infof("outbox-worker: started (batch=%d, interval=%s)", cfg.Outbox.BatchSize, cfg.Outbox.PollInterval)
+		shutdown := lifecycle.Listen(cmd.Context(), cfg.Shutdown.GracePeriod)
+		defer shutdown.Close()
+		if err := runOutboxWorker(shutdown, cfg, db, natsClient, log); err != nil {
+			fmt.Fprintln(os.Stderr, "outbox config error:", err)
+			os.Exit(1)
+		}
+	},
+}
 
-		ticker := time.NewTicker(cfg.Outbox.PollInterval)
-		defer ticker.Stop()
+// runOutboxWorker publishes outbox events through publisher until shutdown
+// begins.
+func runOutboxWorker(shutdown *lifecycle.Shutdown, cfg config.Config, db *persistence.DB, publisher broker.Publisher, log *logrus.Logger) error {
+	repo := persistence.NewOutboxRepository(db)
+	coord, err := coordination.New(cfg.Outbox, persistence.NewLeaseRepository(db))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		coord.Release(releaseCtx)
+	}()
+	signer, err := messaging.NewSigner(cfg.NATS.Signing)
+	if err != nil {
+		return err
+	}
+	if signer != nil {
+		log.Infof("outbox-worker: signing with key %s", signer.KeyID())
+	}
+	breaker := messaging.NewCircuitBreaker(cfg.Outbox.BreakerFailures, cfg.Outbox.BreakerOpenTimeout, cfg.Outbox.BreakerHalfOpenTrials)
+	breaker.OnStateChange(func(from, to messaging.BreakerState) {
+		log.Warnf("outbox-worker: circuit breaker %s -> %s", from, to)
+	})
 
-		for {
-			if err := processOutbox(cmd.Context(), cfg, repo, natsClient, log); err != nil {
+	worker := &outboxWorker{
+		cfg:       cfg,
+		repo:      repo,
+		coord:     coord,
+		publisher: messaging.SignedPublisher(breaker.Wrap(publisher), signer),
+		breaker:   breaker,
+		log:       log,
+	}
+	if cfg.Outbox.PublishRate > 0 {
+		burst := cfg.Outbox.PublishBurst
+		if burst <= 0 {
+			burst = 1
+		}
+		worker.limiter = rate.NewLimiter(rate.Limit(cfg.Outbox.PublishRate), burst)
+	}
+	stopping := shutdown.Stopping()
+
+	log.Infof("outbox-worker: started (batch=%d, interval=%s, coordination=%s, worker=%s, rate=%g/s)",
+		cfg.Outbox.BatchSize, cfg.Outbox.PollInterval, cfg.Outbox.Coordination, coord.WorkerID(), cfg.Outbox.PublishRate)
+
+	ticker := time.NewTicker(cfg.Outbox.PollInterval)
+	defer ticker.Stop()
+
+	active := false
+	for {
+		assign, err := coord.Sync(stopping)
+		if err != nil {
+			log.WithError(err).Warn("outbox-worker: coordination sync failed")
+		}
+		if assign.Active != active {
+			active = assign.Active
+			log.Infof("outbox-worker: active=%t shards=%v", assign.Active, assign.Shards)
+		}
+		if assign.Active {
+			if err := worker.process(stopping, shutdown.Work(), assign); err != nil {
 				log.WithError(err).Warn("outbox-worker: process failed")
 			}
-			select {
-			case <-cmd.Context().Done():
-				return
-			case <-ticker.C:
-			}
 		}
-	},
+		select {
+		case <-stopping.Done():
+			log.Info("outbox-worker: stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+type outboxWorker struct {
+	cfg       config.Config
+	repo      *persistence.OutboxRepository
+	coord     coordination.Coordinator
+	publisher broker.Publisher
+	breaker   *messaging.CircuitBreaker
+	limiter   *rate.Limiter
+	log       *logrus.Logger
+}
+
+// batchSize shrinks the claim so that rows are not claimed while the
+// breaker rejects publishes, and so that a rate-limited batch is published
+// well within the lock timeout.
+func (w *outboxWorker) batchSize() int {
+	limit := w.cfg.Outbox.BatchSize
+	if limit <= 0 {
+		limit = 100
+	}
+	if capacity := w.breaker.Capacity(); capacity >= 0 && capacity < limit {
+		limit = capacity
+	}
+	if w.limiter != nil {
+		lockTimeout := w.cfg.Outbox.LockTimeout
+		if lockTimeout <= 0 {
+			lockTimeout = time.Minute
+		}
+		if budget := int(float64(w.limiter.Limit()) * lockTimeout.Seconds() / 2); budget < limit {
+			limit = max(budget, 1)
+		}
+	}
+	return limit
 }
 
-func processOutbox(ctx context.Context, cfg config.Config, repo *persistence.OutboxRepository, natsClient *messaging.NATSClient, log *logrus.Logger) error {
-	events, err := repo.Claim(ctx, cfg.Outbox.BatchSize, cfg.Outbox.LockTimeout, cfg.Outbox.MaxAttempts)
+// process claims a batch unless shutdown has begun (stopping) and publishes
+// it until the grace period runs out (ctx). Whatever is left then is
+// released so other workers can take it without waiting for the lock to
+// time out.
+func (w *outboxWorker) process(stopping, ctx context.Context, assign coordination.Assignment) error {
+	if stopping.Err() != nil {
+		return nil
+	}
+	limit := w.batchSize()
+	if limit == 0 {
+		w.log.Debug("outbox-worker: circuit breaker open, skipping claim")
+		return nil
+	}
+
+	ctx, stopRenewing := w.renewLeases(ctx)
+	defer stopRenewing()
+
+	var (
+		events []entity.OutboxEvent
+		err    error
+	)
+	if assign.Ordered {
+		events, err = w.repo.ClaimOrdered(ctx, limit, w.cfg.Outbox.LockTimeout, w.cfg.Outbox.MaxAttempts, assign.ShardCount, assign.Shards)
+	} else {
+		events, err = w.repo.Claim(ctx, limit, w.cfg.Outbox.LockTimeout, w.cfg.Outbox.MaxAttempts)
+	}
 	if err != nil {
 		return err
 	}
-	for _, event := range events {
-		subject := event.EventType
-		if event.EventType == "user.created" {
-			subject = cfg.NATS.UserCreatedSubject
+
+	// Once an event fails, later events of the same aggregate in this batch
+	// are handed back untouched so they cannot overtake it. When the breaker
+	// opens or the grace period runs out, everything left is handed back.
+	blocked := make(map[uuid.UUID]bool)
+	var skipped []uuid.UUID
+	for i, event := range events {
+		if blocked[event.AggregateID] {
+			skipped = append(skipped, event.ID)
+			continue
 		}
-		if err := natsClient.Publish(ctx, subject, event.Payload, event.AggregateID.String()); err != nil {
-			if err := repo.MarkFailed(ctx, event.ID, err.Error()); err != nil {
-				log.WithError(err).Warn("outbox-worker: mark failed")
+		if w.limiter != nil {
+			if err := w.limiter.Wait(ctx); err != nil {
+				skipped = appendIDs(skipped, events[i:])
+				break
 			}
+		}
+		if err := messaging.PublishOutboxEvent(ctx, w.publisher, w.cfg.NATS, event); err != nil {
+			if errors.Is(err, messaging.ErrCircuitOpen) || ctx.Err() != nil {
+				skipped = appendIDs(skipped, events[i:])
+				break
+			}
+			if err := w.repo.MarkFailed(context.WithoutCancel(ctx), event.ID, err.Error()); err != nil {
+				w.log.WithError(err).Warn("outbox-worker: mark failed")
+			}
+			blocked[event.AggregateID] = true
 			continue
 		}
-		if err := repo.MarkProcessed(ctx, event.ID); err != nil {
-			log.WithError(err).Warn("outbox-worker: mark processed")
+		if err := w.repo.MarkProcessed(context.WithoutCancel(ctx), event.ID); err != nil {
+			w.log.WithError(err).Warn("outbox-worker: mark processed")
 		}
 	}
+	if err := w.repo.Release(context.WithoutCancel(ctx), skipped); err != nil {
+		w.log.WithError(err).Warn("outbox-worker: release skipped")
+	}
 	return nil
 }
 
+// renewLeases keeps the coordination leases alive while a batch is being
+// published, since a rate-limited batch can outlast lease_ttl. The returned
+// context is cancelled once a lease is lost, so the rest of the batch is
+// handed back instead of racing the new holder.
+func (w *outboxWorker) renewLeases(ctx context.Context) (context.Context, func()) {
+	interval := w.coord.RenewInterval()
+	if interval <= 0 {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ok, err := w.coord.Renew(ctx)
+				if err != nil || !ok {
+					w.log.WithError(err).Warn("outbox-worker: lease lost mid-batch, handing back the rest")
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return ctx, func() {
+		close(done)
+		<-stopped
+		cancel()
+	}
+}
+
+func appendIDs(ids []uuid.UUID, events []entity.OutboxEvent) []uuid.UUID {
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
 func init() {
 	rootCmd.AddCommand(outboxCmd)
 }
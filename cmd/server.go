@@ -7,11 +7,10 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
 
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/bootstrap"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/lifecycle"
 	"github.com/spf13/cobra"
 )
 
@@ -26,15 +25,15 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-		defer stop()
-
 		cfg, err := config.Load(cfgFile)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "config error:", err)
 			os.Exit(1)
 		}
-		if err := bootstrap.Run(ctx, cfg); err != nil {
+		shutdown := lifecycle.Listen(context.Background(), cfg.Shutdown.GracePeriod)
+		defer shutdown.Close()
+
+		if err := bootstrap.Run(shutdown.Stopping(), cfg); err != nil {
 			fmt.Fprintln(os.Stderr, "server error:", err)
 			os.Exit(1)
 		}
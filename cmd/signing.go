@@ -0,0 +1,81 @@
+/*
+Copyright © 2026 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/signing"
+	"github.com/spf13/cobra"
+)
+
+var (
+	signingAlgorithm string
+	signingKeyID     string
+	signingDir       string
+)
+
+var signingCmd = &cobra.Command{
+	Use:   "signing",
+	Short: "Manage the keys events are signed with",
+}
+
+var signingKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a signing key",
+	Long: `Writes <id>.key to --dir. For ed25519 it also writes <id>.pub, which is
+all consumers need; HMAC consumers need the .key file itself. Existing files
+are never overwritten.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if signingKeyID == "" {
+			fmt.Fprintln(os.Stderr, "signing error: --id is required")
+			os.Exit(1)
+		}
+		private, public, err := signing.GenerateKey(signingAlgorithm)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "signing error:", err)
+			os.Exit(1)
+		}
+		if err := os.MkdirAll(signingDir, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, "signing error:", err)
+			os.Exit(1)
+		}
+		if err := writeKeyFile(filepath.Join(signingDir, signingKeyID+".key"), private, 0o600); err != nil {
+			fmt.Fprintln(os.Stderr, "signing error:", err)
+			os.Exit(1)
+		}
+		if signingAlgorithm == signing.AlgorithmEd25519 {
+			if err := writeKeyFile(filepath.Join(signingDir, signingKeyID+".pub"), public, 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, "signing error:", err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func writeKeyFile(path string, data []byte, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Println("wrote", path)
+	return nil
+}
+
+func init() {
+	signingKeygenCmd.Flags().StringVar(&signingAlgorithm, "algorithm", signing.AlgorithmEd25519, "ed25519 or hmac-sha256")
+	signingKeygenCmd.Flags().StringVar(&signingKeyID, "id", "", "key id, used as the file name")
+	signingKeygenCmd.Flags().StringVar(&signingDir, "dir", ".", "directory to write the key files to")
+	signingCmd.AddCommand(signingKeygenCmd)
+	rootCmd.AddCommand(signingCmd)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2026 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/bootstrap"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/messaging"
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/cobra"
+)
+
+var streamAllowDestructive bool
+
+var streamCmd = &cobra.Command{
+	Use:   "stream",
+	Short: "Compare and apply the JetStream streams declared in config",
+}
+
+var streamDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show how the server's streams differ from config",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, streams := dialStreams(cmd.Context())
+		defer client.Close()
+
+		for _, desired := range streams {
+			plan := planStream(cmd.Context(), client, desired)
+			printStreamPlan(plan)
+		}
+	},
+}
+
+var streamApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create or update the streams declared in config",
+	Long: `Creates missing streams and applies config changes to existing ones.
+Changes that can drop stored messages (tighter limits, a storage change,
+which recreates the stream) are refused unless --allow-destructive is set.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, streams := dialStreams(cmd.Context())
+		defer client.Close()
+
+		for _, desired := range streams {
+			plan := planStream(cmd.Context(), client, desired)
+			printStreamPlan(plan)
+			if err := messaging.ApplyStream(cmd.Context(), client.JetStream(), plan, streamAllowDestructive); err != nil {
+				fmt.Fprintln(os.Stderr, "stream error:", err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func dialStreams(ctx context.Context) (*messaging.NATSClient, []nats.StreamConfig) {
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config error:", err)
+		os.Exit(1)
+	}
+	log, err := bootstrap.BuildLogger(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "log error:", err)
+		os.Exit(1)
+	}
+	streams, err := messaging.DesiredStreams(cfg.NATS)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config error:", err)
+		os.Exit(1)
+	}
+	client, err := messaging.Dial(ctx, cfg.NATS, log)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "nats error:", err)
+		os.Exit(1)
+	}
+	if client == nil {
+		fmt.Fprintln(os.Stderr, "nats error: nats url is required")
+		os.Exit(1)
+	}
+	return client, streams
+}
+
+func planStream(ctx context.Context, client *messaging.NATSClient, desired nats.StreamConfig) messaging.StreamPlan {
+	plan, err := messaging.PlanStream(ctx, client.JetStream(), desired)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "stream error:", err)
+		os.Exit(1)
+	}
+	return plan
+}
+
+func printStreamPlan(plan messaging.StreamPlan) {
+	switch {
+	case plan.Create:
+		fmt.Printf("stream %s: create\n", plan.Desired.Name)
+	case plan.Empty():
+		fmt.Printf("stream %s: up to date\n", plan.Desired.Name)
+	default:
+		fmt.Printf("stream %s:\n", plan.Desired.Name)
+		for _, c := range plan.Changes {
+			fmt.Printf("  %s\n", c)
+		}
+	}
+}
+
+func init() {
+	streamApplyCmd.Flags().BoolVar(&streamAllowDestructive, "allow-destructive", false, "apply changes that can drop stored messages")
+	streamCmd.AddCommand(streamDiffCmd, streamApplyCmd)
+	rootCmd.AddCommand(streamCmd)
+}
@@ -0,0 +1,46 @@
+package bootstrap
+
+import (
+	"context"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/persistence"
+)
+
+func MaintainInbox(ctx context.Context, cfg config.Config, dryRun bool) error {
+	log, err := buildLogger(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.NATS.InboxRetention <= 0 {
+		log.Info("inbox-maintenance: retention disabled, nothing to prune")
+		return nil
+	}
+
+	conn, err := persistence.New(ctx, persistence.Config{
+		WriteDSN:          cfg.Database.WriteDSN,
+		ReadDSN:           cfg.Database.ReadDSN,
+		MaxConns:          cfg.Database.MaxConns,
+		MinConns:          cfg.Database.MinConns,
+		MaxConnLifetime:   cfg.Database.MaxConnLifetime,
+		MaxConnIdleTime:   cfg.Database.MaxConnIdleTime,
+		HealthCheckPeriod: cfg.Database.HealthCheckPeriod,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	cutoff := time.Now().UTC().Add(-cfg.NATS.InboxRetention)
+	log.Infof("inbox-maintenance: prune consumer inbox entries processed before %s", cutoff.Format(time.RFC3339))
+	if dryRun {
+		return nil
+	}
+	pruned, err := persistence.NewInboxRepository(conn).Prune(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	log.Infof("inbox-maintenance: pruned %d consumer inbox entries", pruned)
+	return nil
+}
@@ -0,0 +1,93 @@
+package bootstrap
+
+import (
+	"context"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/persistence"
+)
+
+func MaintainOutbox(ctx context.Context, cfg config.Config, dryRun bool) error {
+	log, err := buildLogger(cfg)
+	if err != nil {
+		return err
+	}
+
+	conn, err := persistence.New(ctx, persistence.Config{
+		WriteDSN:          cfg.Database.WriteDSN,
+		ReadDSN:           cfg.Database.ReadDSN,
+		MaxConns:          cfg.Database.MaxConns,
+		MinConns:          cfg.Database.MinConns,
+		MaxConnLifetime:   cfg.Database.MaxConnLifetime,
+		MaxConnIdleTime:   cfg.Database.MaxConnIdleTime,
+		HealthCheckPeriod: cfg.Database.HealthCheckPeriod,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	repo := persistence.NewOutboxPartitionRepository(conn)
+	partitions, err := repo.List(ctx)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(partitions))
+	for _, p := range partitions {
+		existing[p.Name] = true
+	}
+
+	// Only days that have not started yet: today's rows are already being
+	// written to the default partition and moving them races the inserts.
+	now := time.Now().UTC()
+	for i := 1; i <= cfg.Outbox.Premake; i++ {
+		p := persistence.OutboxPartitionFor(now.Add(time.Duration(i) * 24 * time.Hour))
+		if existing[p.Name] {
+			continue
+		}
+		log.Infof("outbox-maintenance: create partition %s [%s, %s)", p.Name, p.From.Format(time.DateOnly), p.To.Format(time.DateOnly))
+		if dryRun {
+			continue
+		}
+		if err := repo.Create(ctx, p); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Outbox.Retention <= 0 {
+		log.Info("outbox-maintenance: retention disabled, nothing to expire")
+		return nil
+	}
+	cutoff := now.Add(-cfg.Outbox.Retention)
+	action := "drop"
+	if cfg.Outbox.ArchiveSchema != "" {
+		action = "archive to " + cfg.Outbox.ArchiveSchema
+	}
+	for _, p := range partitions {
+		if p.To.After(cutoff) {
+			continue
+		}
+		log.Infof("outbox-maintenance: %s partition %s", action, p.Name)
+		if dryRun {
+			continue
+		}
+		retained, err := repo.Expire(ctx, p, cfg.Outbox.ArchiveSchema)
+		if err != nil {
+			return err
+		}
+		if retained > 0 {
+			log.Warnf("outbox-maintenance: kept %d unprocessed events from %s in the default partition", retained, p.Name)
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+	purged, err := repo.PurgeDefault(ctx, cutoff, cfg.Outbox.ArchiveSchema)
+	if err != nil {
+		return err
+	}
+	log.Infof("outbox-maintenance: removed %d processed events from the default partition", purged)
+	return nil
+}
@@ -38,6 +38,11 @@ func Seed(ctx context.Context, cfg config.Config, count, batchSize int) error {
 		return err
 	}
 	defer conn.Close()
+	raw, err := rawPayloads(cfg.Outbox)
+	if err != nil {
+		return err
+	}
+	conn.StoreRawPayloads(raw)
 
 	pingCtx := ctx
 	if cfg.Database.ConnectTimeout > 0 {
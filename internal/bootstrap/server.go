@@ -3,10 +3,13 @@ package bootstrap
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/messaging"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/persistence"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/transport/http/handlers"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/transport/http/middleware"
@@ -48,14 +51,63 @@ func Run(ctx context.Context, cfg config.Config) error {
 	}
 	log.Infof("bootstrap: db ping in %s", time.Since(start))
 
+	opts := ServerOptions{DB: conn}
+	if len(cfg.Outbox.DirectDispatch) > 0 {
+		natsClient, err := messaging.NewNATS(ctx, cfg.NATS, log)
+		switch {
+		case err != nil:
+			log.WithError(err).Warn("bootstrap: nats unavailable, outbox-worker will publish all events")
+		case natsClient == nil:
+			log.Warn("bootstrap: nats url not set, direct dispatch disabled")
+		default:
+			defer natsClient.Close()
+			opts.Publisher = natsClient
+			opts.HealthChecks = map[string]func(ctx context.Context) error{
+				"nats": func(ctx context.Context) error { return natsClient.Healthy() },
+			}
+		}
+	}
+	return Serve(ctx, cfg, opts, log)
+}
+
+// ServerOptions carries what Serve needs beyond config.
+type ServerOptions struct {
+	DB *persistence.DB
+	// Publisher enables direct dispatch of cfg.Outbox.DirectDispatch events.
+	Publisher    broker.Publisher
+	HealthChecks map[string]func(ctx context.Context) error
+}
+
+// Serve runs the HTTP API until ctx ends.
+func Serve(ctx context.Context, cfg config.Config, opts ServerOptions, log *logrus.Logger) error {
+	conn := opts.DB
+	raw, err := rawPayloads(cfg.Outbox)
+	if err != nil {
+		return err
+	}
+	conn.StoreRawPayloads(raw)
+	if opts.Publisher != nil && len(cfg.Outbox.DirectDispatch) > 0 {
+		signer, err := messaging.NewSigner(cfg.NATS.Signing)
+		if err != nil {
+			return err
+		}
+		dispatcher := messaging.NewOutboxDispatcher(messaging.SignedPublisher(opts.Publisher, signer), cfg.NATS, cfg.Outbox, persistence.NewOutboxRepository(conn), log)
+		defer dispatcher.Wait()
+		conn.SetOutboxDispatcher(dispatcher)
+		log.Infof("bootstrap: direct dispatch enabled for %v", cfg.Outbox.DirectDispatch)
+	}
+
 	userRepo := persistence.NewUserRepository(conn)
 	userUC := usecase.NewUser(userRepo, log)
 
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
-	router.Use(middleware.RequestID(), middleware.Logger(log), gin.Recovery())
+	router.Use(middleware.RequestID(), middleware.Trace(), middleware.Logger(log), gin.Recovery())
 	allowBypassIdemKey := cfg.Env != "prod"
 	handler := handlers.NewHandler(userUC, conn)
+	for name, check := range opts.HealthChecks {
+		handler.AddHealthCheck(name, check)
+	}
 	routerBuilder := handlers.NewRouter(handler)
 	routerBuilder.RegisterRoutes(router, middleware.IdempotencyRequired(allowBypassIdemKey))
 
@@ -81,7 +133,7 @@ func Run(ctx context.Context, cfg config.Config) error {
 		log.WithError(err).Error("server error")
 	}
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.GracePeriod)
 	defer cancel()
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.WithError(err).Error("server shutdown error")
@@ -112,3 +164,14 @@ func buildLogger(cfg config.Config) (*logrus.Logger, error) {
 	}
 	return log, nil
 }
+
+func rawPayloads(cfg config.Outbox) (bool, error) {
+	switch cfg.PayloadStorage {
+	case "", "json":
+		return false, nil
+	case "raw":
+		return true, nil
+	default:
+		return false, fmt.Errorf("bootstrap: outbox payload_storage %q: supported values are json or raw", cfg.PayloadStorage)
+	}
+}
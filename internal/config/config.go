@@ -32,6 +32,7 @@ type Config struct {
 	Log      Log      `mapstructure:"log"`
 	NATS     NATS     `mapstructure:"nats"`
 	Outbox   Outbox   `mapstructure:"outbox"`
+	Shutdown Shutdown `mapstructure:"shutdown"`
 	Env      string   `mapstructure:"environment"`
 }
 
@@ -42,6 +43,10 @@ type Server struct {
 	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
 }
 
+type Shutdown struct {
+	GracePeriod time.Duration `mapstructure:"grace_period"`
+}
+
 type Log struct {
 	Level  string `mapstructure:"level"`
 	Format string `mapstructure:"format"`
@@ -49,21 +54,122 @@ type Log struct {
 
 type NATS struct {
 	URL                string          `mapstructure:"url"`
+	URLs               []string        `mapstructure:"urls"`
+	CredsFile          string          `mapstructure:"creds_file"`
+	NKeyFile           string          `mapstructure:"nkey_file"`
+	Token              string          `mapstructure:"token"`
+	User               string          `mapstructure:"user"`
+	Password           string          `mapstructure:"password"`
+	TLS                NATSTLS         `mapstructure:"tls"`
+	ConnectTimeout     time.Duration   `mapstructure:"connect_timeout"`
+	ReconnectWait      time.Duration   `mapstructure:"reconnect_wait"`
+	MaxReconnects      int             `mapstructure:"max_reconnects"`
 	Stream             string          `mapstructure:"stream"`
 	UserCreatedSubject string          `mapstructure:"user_created_subject"`
+	UserUpdatedSubject string          `mapstructure:"user_updated_subject"`
+	UserDeletedSubject string          `mapstructure:"user_deleted_subject"`
+	UserEmailSubject   string          `mapstructure:"user_email_changed_subject"`
 	DLQSubject         string          `mapstructure:"dlq_subject"`
+	DLQStream          string          `mapstructure:"dlq_stream"`
+	DLQMaxAge          time.Duration   `mapstructure:"dlq_max_age"`
+	StreamOptions      StreamOptions   `mapstructure:"stream_options"`
+	DLQStreamOptions   StreamOptions   `mapstructure:"dlq_stream_options"`
 	ConsumerDurable    string          `mapstructure:"consumer_durable"`
 	AckWait            time.Duration   `mapstructure:"ack_wait"`
 	MaxAckPending      int             `mapstructure:"max_ack_pending"`
 	ConsumerMaxDeliver int             `mapstructure:"consumer_max_deliver"`
 	ConsumerBackoff    []time.Duration `mapstructure:"consumer_backoff"`
+	Consumers          []Consumer      `mapstructure:"consumers"`
+	InboxRetention     time.Duration   `mapstructure:"inbox_retention"`
+	CloudEvents        CloudEvents     `mapstructure:"cloudevents"`
+	// Encoding is the wire format of event data: "json" or "protobuf".
+	// Event types without a protobuf message are always sent as JSON.
+	Encoding string  `mapstructure:"encoding"`
+	Signing  Signing `mapstructure:"signing"`
+}
+
+// Signing configures message signatures. Publishers sign with KeyFile
+// under KeyID when it is set. Consumers trust VerifyKeys plus the signing
+// key. Once any key is trusted, unsigned messages are dead-lettered unless
+// AllowUnsigned opts out for a rollout.
+type Signing struct {
+	KeyID         string       `mapstructure:"key_id"`
+	KeyFile       string       `mapstructure:"key_file"`
+	VerifyKeys    []SigningKey `mapstructure:"verify_keys"`
+	AllowUnsigned bool         `mapstructure:"allow_unsigned"`
+}
+
+type SigningKey struct {
+	ID   string `mapstructure:"id"`
+	File string `mapstructure:"file"`
+}
+
+// CloudEvents controls the envelope published events are wrapped in. Mode
+// is "binary" (ce-* headers), "structured" (JSON body) or "none".
+// DataSchema may use the {type} and {version} placeholders.
+type CloudEvents struct {
+	Mode       string `mapstructure:"mode"`
+	Source     string `mapstructure:"source"`
+	DataSchema string `mapstructure:"dataschema"`
+}
+
+type NATSTLS struct {
+	CAFile   string `mapstructure:"ca_file"`
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+// StreamOptions declares a JetStream stream. Zero limits mean unlimited.
+type StreamOptions struct {
+	Storage           string        `mapstructure:"storage"`
+	MaxAge            time.Duration `mapstructure:"max_age"`
+	MaxBytes          int64         `mapstructure:"max_bytes"`
+	MaxMsgsPerSubject int64         `mapstructure:"max_msgs_per_subject"`
+	Replicas          int           `mapstructure:"replicas"`
+	Discard           string        `mapstructure:"discard"`
+	DuplicateWindow   time.Duration `mapstructure:"duplicate_window"`
+	Compression       string        `mapstructure:"compression"`
+}
+
+type Consumer struct {
+	Name              string          `mapstructure:"name"`
+	Durable           string          `mapstructure:"durable"`
+	Subjects          []string        `mapstructure:"subjects"`
+	Handlers          []string        `mapstructure:"handlers"`
+	Concurrency       int             `mapstructure:"concurrency"`
+	OrderingKey       string          `mapstructure:"ordering_key"`
+	BatchSize         int             `mapstructure:"batch_size"`
+	FetchWait         time.Duration   `mapstructure:"fetch_wait"`
+	AckWait           time.Duration   `mapstructure:"ack_wait"`
+	MaxAckPending     int             `mapstructure:"max_ack_pending"`
+	MaxDeliver        int             `mapstructure:"max_deliver"`
+	Backoff           []time.Duration `mapstructure:"backoff"`
+	MaxProcessingTime time.Duration   `mapstructure:"max_processing_time"`
+	DLQSubject        string          `mapstructure:"dlq_subject"`
 }
 
 type Outbox struct {
-	BatchSize    int           `mapstructure:"batch_size"`
-	PollInterval time.Duration `mapstructure:"poll_interval"`
-	LockTimeout  time.Duration `mapstructure:"lock_timeout"`
-	MaxAttempts  int           `mapstructure:"max_attempts"`
+	BatchSize             int           `mapstructure:"batch_size"`
+	PollInterval          time.Duration `mapstructure:"poll_interval"`
+	LockTimeout           time.Duration `mapstructure:"lock_timeout"`
+	MaxAttempts           int           `mapstructure:"max_attempts"`
+	Coordination          string        `mapstructure:"coordination"`
+	WorkerID              string        `mapstructure:"worker_id"`
+	LeaseTTL              time.Duration `mapstructure:"lease_ttl"`
+	ShardCount            int           `mapstructure:"shard_count"`
+	Retention             time.Duration `mapstructure:"retention"`
+	Premake               int           `mapstructure:"partition_premake"`
+	ArchiveSchema         string        `mapstructure:"archive_schema"`
+	DirectDispatch        []string      `mapstructure:"direct_dispatch"`
+	DirectDispatchTimeout time.Duration `mapstructure:"direct_dispatch_timeout"`
+	PublishRate           float64       `mapstructure:"publish_rate"`
+	PublishBurst          int           `mapstructure:"publish_burst"`
+	BreakerFailures       int           `mapstructure:"breaker_failures"`
+	BreakerOpenTimeout    time.Duration `mapstructure:"breaker_open_timeout"`
+	BreakerHalfOpenTrials int           `mapstructure:"breaker_half_open_trials"`
+	// PayloadStorage is "json" (JSONB payload) or "raw" (protobuf bytes in
+	// payload_raw for event types that have a protobuf message).
+	PayloadStorage string `mapstructure:"payload_storage"`
 }
 
 func Load(cfgFile string) (Config, error) {
@@ -83,6 +189,9 @@ func Load(cfgFile string) (Config, error) {
 	v.AutomaticEnv()
 	_ = v.BindEnv("database.user", "DB_USER")
 	_ = v.BindEnv("database.password", "DB_PASS")
+	_ = v.BindEnv("nats.token", "NATS_TOKEN")
+	_ = v.BindEnv("nats.user", "NATS_USER")
+	_ = v.BindEnv("nats.password", "NATS_PASS")
 
 	v.SetDefault("database.max_conns", 20)
 	v.SetDefault("database.min_conns", 0)
@@ -98,17 +207,53 @@ func Load(cfgFile string) (Config, error) {
 	v.SetDefault("server.idle_timeout", "60s")
 	v.SetDefault("log.level", "info")
 	v.SetDefault("log.format", "console")
+	v.SetDefault("nats.connect_timeout", "5s")
+	v.SetDefault("nats.reconnect_wait", "2s")
+	v.SetDefault("nats.max_reconnects", -1)
 	v.SetDefault("nats.stream", "events")
 	v.SetDefault("nats.user_created_subject", "user.created")
+	v.SetDefault("nats.user_updated_subject", "user.updated")
+	v.SetDefault("nats.user_deleted_subject", "user.deleted")
+	v.SetDefault("nats.user_email_changed_subject", "user.email_changed")
 	v.SetDefault("nats.dlq_subject", "user.created.dlq")
+	v.SetDefault("nats.dlq_stream", "events-dlq")
+	v.SetDefault("nats.dlq_max_age", "720h")
+	for _, key := range []string{"nats.stream_options", "nats.dlq_stream_options"} {
+		v.SetDefault(key+".storage", "file")
+		v.SetDefault(key+".replicas", 1)
+		v.SetDefault(key+".discard", "old")
+		v.SetDefault(key+".duplicate_window", "2m")
+		v.SetDefault(key+".compression", "none")
+	}
 	v.SetDefault("nats.consumer_durable", "user-created-worker")
 	v.SetDefault("nats.ack_wait", "30s")
 	v.SetDefault("nats.max_ack_pending", 256)
 	v.SetDefault("nats.consumer_max_deliver", 10)
+	v.SetDefault("nats.inbox_retention", "168h")
+	v.SetDefault("nats.cloudevents.mode", "binary")
+	v.SetDefault("nats.cloudevents.source", "/simple-backend")
+	v.SetDefault("nats.cloudevents.dataschema", "urn:simple-backend:schema:{type}:v{version}")
+	v.SetDefault("nats.encoding", "json")
+	v.SetDefault("nats.signing.key_id", "")
+	v.SetDefault("nats.signing.key_file", "")
+	v.SetDefault("nats.signing.allow_unsigned", false)
 	v.SetDefault("outbox.batch_size", 100)
 	v.SetDefault("outbox.poll_interval", "2s")
 	v.SetDefault("outbox.lock_timeout", "60s")
 	v.SetDefault("outbox.max_attempts", 10)
+	v.SetDefault("outbox.coordination", "none")
+	v.SetDefault("outbox.lease_ttl", "15s")
+	v.SetDefault("outbox.shard_count", 16)
+	v.SetDefault("outbox.retention", 0)
+	v.SetDefault("outbox.partition_premake", 7)
+	v.SetDefault("outbox.direct_dispatch_timeout", "5s")
+	v.SetDefault("outbox.publish_rate", 0)
+	v.SetDefault("outbox.publish_burst", 50)
+	v.SetDefault("outbox.breaker_failures", 5)
+	v.SetDefault("outbox.breaker_open_timeout", "30s")
+	v.SetDefault("outbox.breaker_half_open_trials", 1)
+	v.SetDefault("outbox.payload_storage", "json")
+	v.SetDefault("shutdown.grace_period", "25s")
 	v.SetDefault("environment", "dev")
 
 	if err := v.ReadInConfig(); err != nil {
@@ -123,9 +268,59 @@ func Load(cfgFile string) (Config, error) {
 	}
 
 	cfg = applyDSNDefaults(cfg)
+	cfg = applyConsumerDefaults(cfg)
 	return cfg, nil
 }
 
+// applyConsumerDefaults keeps the single-durable settings working: without
+// nats.consumers, one "audit-log" consumer is built from them. Unset
+// per-consumer fields inherit the nats-level values.
+func applyConsumerDefaults(cfg Config) Config {
+	if len(cfg.NATS.Consumers) == 0 && cfg.NATS.ConsumerDurable != "" && cfg.NATS.UserCreatedSubject != "" {
+		cfg.NATS.Consumers = []Consumer{{
+			Name:       "audit-log",
+			Durable:    cfg.NATS.ConsumerDurable,
+			Subjects:   []string{cfg.NATS.UserCreatedSubject},
+			Handlers:   []string{"audit-log"},
+			DLQSubject: cfg.NATS.DLQSubject,
+		}}
+	}
+	for i := range cfg.NATS.Consumers {
+		c := &cfg.NATS.Consumers[i]
+		if c.Durable == "" {
+			c.Durable = c.Name
+		}
+		if c.Concurrency <= 0 {
+			c.Concurrency = 1
+		}
+		if c.MaxProcessingTime <= 0 {
+			c.MaxProcessingTime = 5 * time.Minute
+		}
+		if c.OrderingKey == "" {
+			c.OrderingKey = "X-Aggregate-ID"
+		}
+		if c.BatchSize <= 0 {
+			c.BatchSize = 50
+		}
+		if c.FetchWait <= 0 {
+			c.FetchWait = 2 * time.Second
+		}
+		if c.AckWait <= 0 {
+			c.AckWait = cfg.NATS.AckWait
+		}
+		if c.MaxAckPending <= 0 {
+			c.MaxAckPending = cfg.NATS.MaxAckPending
+		}
+		if c.MaxDeliver == 0 {
+			c.MaxDeliver = cfg.NATS.ConsumerMaxDeliver
+		}
+		if len(c.Backoff) == 0 {
+			c.Backoff = cfg.NATS.ConsumerBackoff
+		}
+	}
+	return cfg
+}
+
 func applyDSNDefaults(cfg Config) Config {
 	if cfg.Database.WriteDSN == "" && cfg.Database.Host != "" && cfg.Database.Name != "" {
 		cfg.Database.WriteDSN = buildDSN(cfg.Database.Host, cfg.Database.Port, cfg.Database.Name, cfg.Database.User, cfg.Database.Password, cfg.Database.SSLMode)
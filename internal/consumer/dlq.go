@@ -0,0 +1,149 @@
+package consumer
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dead-letter envelope. The DLQ message keeps the original payload and
+// headers and adds the failure context below.
+const (
+	HeaderDLQSubject        = "X-DLQ-Original-Subject"
+	HeaderDLQStream         = "X-DLQ-Original-Stream"
+	HeaderDLQSequence       = "X-DLQ-Original-Sequence"
+	HeaderDLQMsgID          = "X-DLQ-Original-Msg-Id"
+	HeaderDLQConsumer       = "X-DLQ-Consumer"
+	HeaderDLQHandler        = "X-DLQ-Handler"
+	HeaderDLQDelivered      = "X-DLQ-Delivered"
+	HeaderDLQPublishedAt    = "X-DLQ-Published-At"
+	HeaderDLQFirstDelivered = "X-DLQ-First-Delivered-At"
+	HeaderDLQFailedAt       = "X-DLQ-Failed-At"
+	HeaderDLQReason         = "X-DLQ-Reason"
+	HeaderDLQError          = "X-DLQ-Error"
+)
+
+const (
+	ReasonMaxDeliver = "max_deliver"
+	ReasonPermanent  = "permanent"
+	ReasonNoHandler  = "no_handler"
+	ReasonSignature  = "signature"
+)
+
+const maxErrorHeader = 1024
+
+// DeadLetter is the failure context carried by a DLQ message.
+type DeadLetter struct {
+	Subject          string
+	Stream           string
+	Sequence         uint64
+	MsgID            string
+	Consumer         string
+	Handler          string
+	Delivered        uint64
+	PublishedAt      time.Time
+	FirstDeliveredAt time.Time
+	FailedAt         time.Time
+	Reason           string
+	Error            string
+}
+
+// Headers returns the envelope headers for d.
+func (d DeadLetter) Headers() map[string]string {
+	headers := map[string]string{
+		HeaderDLQSubject:   d.Subject,
+		HeaderDLQStream:    d.Stream,
+		HeaderDLQSequence:  strconv.FormatUint(d.Sequence, 10),
+		HeaderDLQMsgID:     d.MsgID,
+		HeaderDLQConsumer:  d.Consumer,
+		HeaderDLQHandler:   d.Handler,
+		HeaderDLQDelivered: strconv.FormatUint(d.Delivered, 10),
+		HeaderDLQReason:    d.Reason,
+		HeaderDLQError:     headerValue(d.Error),
+	}
+	for k, t := range map[string]time.Time{
+		HeaderDLQPublishedAt:    d.PublishedAt,
+		HeaderDLQFirstDelivered: d.FirstDeliveredAt,
+		HeaderDLQFailedAt:       d.FailedAt,
+	} {
+		if !t.IsZero() {
+			headers[k] = t.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return headers
+}
+
+// ParseDeadLetter reads the envelope headers back. Missing or malformed
+// values are left zero.
+func ParseDeadLetter(headers map[string]string) DeadLetter {
+	d := DeadLetter{
+		Subject:  headers[HeaderDLQSubject],
+		Stream:   headers[HeaderDLQStream],
+		MsgID:    headers[HeaderDLQMsgID],
+		Consumer: headers[HeaderDLQConsumer],
+		Handler:  headers[HeaderDLQHandler],
+		Reason:   headers[HeaderDLQReason],
+		Error:    headers[HeaderDLQError],
+	}
+	d.Sequence, _ = strconv.ParseUint(headers[HeaderDLQSequence], 10, 64)
+	d.Delivered, _ = strconv.ParseUint(headers[HeaderDLQDelivered], 10, 64)
+	d.PublishedAt, _ = time.Parse(time.RFC3339Nano, headers[HeaderDLQPublishedAt])
+	d.FirstDeliveredAt, _ = time.Parse(time.RFC3339Nano, headers[HeaderDLQFirstDelivered])
+	d.FailedAt, _ = time.Parse(time.RFC3339Nano, headers[HeaderDLQFailedAt])
+	return d
+}
+
+// headerValue flattens s onto one line and caps its length, since header
+// values cannot contain line breaks.
+func headerValue(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > maxErrorHeader {
+		s = s[:maxErrorHeader]
+	}
+	return s
+}
+
+// deliveries remembers when this process first saw a stream sequence.
+// JetStream metadata only has the publish time, so a message first
+// delivered to another process falls back to that.
+type deliveries struct {
+	mu    sync.Mutex
+	first map[uint64]time.Time
+}
+
+func newDeliveries() *deliveries {
+	return &deliveries{first: make(map[uint64]time.Time)}
+}
+
+func (d *deliveries) seen(msg Message, now time.Time) time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t, ok := d.first[msg.Sequence]; ok {
+		return t
+	}
+	t := now
+	if msg.NumDelivered > 1 {
+		t = msg.Timestamp
+	}
+	d.first[msg.Sequence] = t
+	return t
+}
+
+func (d *deliveries) forget(seq uint64) {
+	d.mu.Lock()
+	delete(d.first, seq)
+	d.mu.Unlock()
+}
+
+// prune drops entries older than horizon, for messages that were
+// redelivered to another process and never came back.
+func (d *deliveries) prune(horizon time.Time) {
+	d.mu.Lock()
+	for seq, t := range d.first {
+		if t.Before(horizon) {
+			delete(d.first, seq)
+		}
+	}
+	d.mu.Unlock()
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/consumer"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/persistence"
+)
+
+const AuditLog = "audit-log"
+
+func NewAuditLog(repo *persistence.AuditLogRepository) consumer.HandlerFunc {
+	return func(ctx context.Context, msg consumer.Message) error {
+		return repo.Create(ctx, msg.Subject, msg.Data, msg.Headers)
+	}
+}
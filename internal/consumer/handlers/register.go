@@ -0,0 +1,11 @@
+package handlers
+
+import (
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/consumer"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/persistence"
+)
+
+// Register adds every application handler to registry.
+func Register(registry *consumer.Registry, db *persistence.DB) {
+	registry.Handle(AuditLog, ">", NewAuditLog(persistence.NewAuditLogRepository(db)))
+}
@@ -0,0 +1,92 @@
+package consumer
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+)
+
+// pool runs messages on a fixed set of lanes. Messages sharing an ordering
+// key always land on the same lane and run one at a time in fetch order;
+// different keys run concurrently. Slots cap the number of messages fetched
+// but not yet finished.
+type pool struct {
+	lanes []chan broker.Delivery
+	slots chan struct{}
+	key   func(broker.Delivery) string
+	next  int
+	wg    sync.WaitGroup
+}
+
+func newPool(lanes, inflight int, key func(broker.Delivery) string, handle func(broker.Delivery)) *pool {
+	lanes = max(lanes, 1)
+	inflight = max(inflight, lanes)
+	p := &pool{
+		lanes: make([]chan broker.Delivery, lanes),
+		slots: make(chan struct{}, inflight),
+		key:   key,
+	}
+	for i := range p.lanes {
+		lane := make(chan broker.Delivery, inflight)
+		p.lanes[i] = lane
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for msg := range lane {
+				handle(msg)
+				<-p.slots
+			}
+		}()
+	}
+	return p
+}
+
+// reserve waits for at least one free slot and takes up to n. It returns 0
+// when ctx ends first.
+func (p *pool) reserve(ctx context.Context, n int) int {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return 0
+	}
+	taken := 1
+	for taken < n {
+		select {
+		case p.slots <- struct{}{}:
+			taken++
+		default:
+			return taken
+		}
+	}
+	return taken
+}
+
+// unreserve gives back slots that a fetch did not fill.
+func (p *pool) unreserve(n int) {
+	for i := 0; i < n; i++ {
+		<-p.slots
+	}
+}
+
+// submit queues msg on its lane. The caller must hold a slot for it.
+func (p *pool) submit(msg broker.Delivery) {
+	lane := p.next % len(p.lanes)
+	if key := p.key(msg); key != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		lane = int(h.Sum32() % uint32(len(p.lanes)))
+	} else {
+		p.next++
+	}
+	p.lanes[lane] <- msg
+}
+
+// drain stops accepting messages and waits for queued ones to finish.
+func (p *pool) drain() {
+	for _, lane := range p.lanes {
+		close(lane)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,157 @@
+package consumer_test
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/consumer"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/messaging"
+	"github.com/sirupsen/logrus"
+)
+
+const orderingHeader = "X-Aggregate-ID"
+
+// laneRecorder tracks how many handlers run at once, overall and per key,
+// and the order each key's messages were handled in.
+type laneRecorder struct {
+	mu        sync.Mutex
+	active    int
+	maxActive int
+	perKey    map[string]int
+	overlap   map[string]bool
+	order     map[string][]uint64
+	handled   int
+}
+
+func newLaneRecorder() *laneRecorder {
+	return &laneRecorder{perKey: map[string]int{}, overlap: map[string]bool{}, order: map[string][]uint64{}}
+}
+
+func (r *laneRecorder) handle(ctx context.Context, msg consumer.Message) error {
+	key := msg.Headers[orderingHeader]
+	r.mu.Lock()
+	r.active++
+	r.maxActive = max(r.maxActive, r.active)
+	r.perKey[key]++
+	if r.perKey[key] > 1 {
+		r.overlap[key] = true
+	}
+	r.order[key] = append(r.order[key], msg.Sequence)
+	r.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	r.mu.Lock()
+	r.active--
+	r.perKey[key]--
+	r.handled++
+	r.mu.Unlock()
+	return nil
+}
+
+// runLanes publishes one message per key in keys, in order, and runs a
+// runtime over them until all are handled.
+func runLanes(t *testing.T, cfg config.Consumer, keys []string) *laneRecorder {
+	t.Helper()
+	mem := messaging.NewMemoryBroker()
+	mem.AddStream("events", []string{"user.>"})
+	rec := newLaneRecorder()
+	registry := consumer.NewRegistry()
+	registry.Handle("record", "user.*", rec.handle)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i, key := range keys {
+		if err := mem.Publish(ctx, "user.updated", []byte(`{}`), fmt.Sprint(i), map[string]string{orderingHeader: key}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	cfg.Name, cfg.Durable, cfg.Subjects, cfg.Handlers = "lanes", "lanes", []string{"user.>"}, []string{"record"}
+	cfg.BatchSize, cfg.FetchWait, cfg.AckWait = 10, 20*time.Millisecond, time.Minute
+	rt := consumer.NewRuntime(mem.Subscriber("events"), mem, nil, cfg, registry, log)
+	done := make(chan error, 1)
+	go func() { done <- rt.Run(ctx, context.Background()) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec.mu.Lock()
+		handled := rec.handled
+		rec.mu.Unlock()
+		if handled == len(keys) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handled %d of %d messages", handled, len(keys))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return rec
+}
+
+// keysOnDistinctLanes returns two keys the pool puts on different lanes.
+func keysOnDistinctLanes(lanes int) (string, string) {
+	lane := func(key string) uint32 {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		return h.Sum32() % uint32(lanes)
+	}
+	first := "user-0"
+	for i := 1; ; i++ {
+		if key := fmt.Sprintf("user-%d", i); lane(key) != lane(first) {
+			return first, key
+		}
+	}
+}
+
+func TestPoolOrdersSameKeyAndParallelizesKeys(t *testing.T) {
+	a, b := keysOnDistinctLanes(4)
+	var keys []string
+	for i := 0; i < 5; i++ {
+		keys = append(keys, a, b)
+	}
+	rec := runLanes(t, config.Consumer{Concurrency: 4, OrderingKey: orderingHeader}, keys)
+
+	for key, overlapped := range rec.overlap {
+		if overlapped {
+			t.Errorf("messages of %s ran concurrently", key)
+		}
+	}
+	for key, seqs := range rec.order {
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i] <= seqs[i-1] {
+				t.Errorf("%s handled out of stream order: %v", key, seqs)
+				break
+			}
+		}
+	}
+	if rec.maxActive < 2 {
+		t.Errorf("different keys never ran in parallel (max active %d)", rec.maxActive)
+	}
+}
+
+func TestPoolCapsInFlightAtMaxAckPending(t *testing.T) {
+	keys := make([]string, 12)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user-%d", i)
+	}
+	rec := runLanes(t, config.Consumer{Concurrency: 8, OrderingKey: "none", MaxAckPending: 3}, keys)
+	if rec.maxActive > 3 {
+		t.Errorf("max active %d exceeds max_ack_pending 3", rec.maxActive)
+	}
+	if rec.maxActive < 2 {
+		t.Errorf("max active %d, want messages to run in parallel up to the cap", rec.maxActive)
+	}
+}
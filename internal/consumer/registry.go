@@ -0,0 +1,157 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/cloudevents"
+)
+
+// Message is a delivered event as seen by a handler. For CloudEvents, Data
+// is the event data and Event the envelope; Event is nil for messages
+// published without one. Data is always at the latest version of its event
+// contract.
+type Message struct {
+	Subject      string
+	Data         []byte
+	Event        *cloudevents.Event
+	Headers      map[string]string
+	Stream       string
+	Sequence     uint64
+	NumDelivered uint64
+	Timestamp    time.Time
+}
+
+type HandlerFunc func(ctx context.Context, msg Message) error
+
+type Handler struct {
+	Name    string
+	Pattern string
+	Func    HandlerFunc
+	// MaxProcessingTime overrides the consumer's max_processing_time.
+	MaxProcessingTime time.Duration
+}
+
+type HandlerOption func(*Handler)
+
+// WithMaxProcessingTime bounds how long the handler may run on one message.
+func WithMaxProcessingTime(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.MaxProcessingTime = d
+	}
+}
+
+// Registry maps subject patterns to handlers. Patterns use NATS wildcards:
+// "*" matches one token and ">" matches the remaining tokens.
+type Registry struct {
+	handlers []Handler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Handle(name, pattern string, fn HandlerFunc, opts ...HandlerOption) {
+	h := Handler{Name: name, Pattern: pattern, Func: fn}
+	for _, opt := range opts {
+		opt(&h)
+	}
+	r.handlers = append(r.handlers, h)
+}
+
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.handlers))
+	for _, h := range r.handlers {
+		names = append(names, h.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select returns a registry with only the named handlers, or every handler
+// when names is empty.
+func (r *Registry) Select(names []string) (*Registry, error) {
+	if len(names) == 0 {
+		return &Registry{handlers: append([]Handler(nil), r.handlers...)}, nil
+	}
+	selected := &Registry{}
+	for _, name := range names {
+		found := false
+		for _, h := range r.handlers {
+			if h.Name == name {
+				selected.handlers = append(selected.handlers, h)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("consumer: unknown handler %q (available: %s)", name, strings.Join(r.Names(), ", "))
+		}
+	}
+	return selected, nil
+}
+
+func (r *Registry) Has(name string) bool {
+	for _, h := range r.handlers {
+		if h.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the first handler among names whose pattern matches subject.
+func (r *Registry) Match(names []string, subject string) (Handler, bool) {
+	for _, h := range r.handlers {
+		if len(names) > 0 && !contains(names, h.Name) {
+			continue
+		}
+		if broker.SubjectMatches(h.Pattern, subject) {
+			return h, true
+		}
+	}
+	return Handler{}, false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrNoHandler is returned for messages no selected handler accepts. Such
+// messages are dead-lettered right away since redelivery cannot help.
+var ErrNoHandler = errors.New("consumer: no handler for subject")
+
+// ErrProcessingTimeout is returned when a handler overruns its max
+// processing time. The message is retried like any other failure.
+var ErrProcessingTimeout = errors.New("consumer: handler exceeded max processing time")
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the runtime dead-letters the message without
+// waiting for the remaining deliveries.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p) || errors.Is(err, ErrNoHandler)
+}
@@ -0,0 +1,448 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/cloudevents"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/events"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/outbox"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/signing"
+	"github.com/sirupsen/logrus"
+)
+
+// Inbox deduplicates deliveries. Process runs fn in the same transaction
+// that records the message, or skips it and reports a duplicate when the
+// message was recorded before.
+type Inbox interface {
+	Process(ctx context.Context, entry entity.ConsumerInbox, fn func(ctx context.Context) error) (duplicate bool, err error)
+}
+
+// Runtime drives one durable pull consumer: it fetches batches, hands each
+// message to the matching handler and acks, naks with backoff or
+// dead-letters the result.
+type Runtime struct {
+	subscriber broker.Subscriber
+	publisher  broker.Publisher
+	inbox      Inbox
+	cfg        config.Consumer
+	registry   *Registry
+	handlers   []string
+	seen       *deliveries
+	verifier   *signing.Verifier
+	log        logrus.FieldLogger
+}
+
+// NewRuntime builds a runtime for cfg. A nil inbox disables deduplication
+// and handlers may see redelivered messages again.
+func NewRuntime(subscriber broker.Subscriber, publisher broker.Publisher, inbox Inbox, cfg config.Consumer, registry *Registry, log logrus.FieldLogger) *Runtime {
+	handlers := make([]string, 0, len(cfg.Handlers))
+	for _, name := range cfg.Handlers {
+		if registry.Has(name) {
+			handlers = append(handlers, name)
+		}
+	}
+	return &Runtime{
+		subscriber: subscriber,
+		publisher:  publisher,
+		inbox:      inbox,
+		cfg:        cfg,
+		registry:   registry,
+		handlers:   handlers,
+		seen:       newDeliveries(),
+		log:        log.WithField("consumer", cfg.Name),
+	}
+}
+
+// VerifySignatures makes the runtime dead-letter messages whose signature
+// v rejects. Handlers then only see the headers the signature covers. A nil
+// v disables verification.
+func (r *Runtime) VerifySignatures(v *signing.Verifier) {
+	r.verifier = v
+}
+
+// Enabled reports whether any of the consumer's handlers was selected.
+func (r *Runtime) Enabled() bool {
+	return len(r.handlers) > 0
+}
+
+// Run consumes until ctx ends. It then stops fetching and finishes the
+// messages it already holds with work; once work ends, the rest are naked
+// so they are redelivered right away instead of after ack_wait.
+func (r *Runtime) Run(ctx, work context.Context) error {
+	sub, err := r.subscriber.Subscribe(ctx, SubscriptionConfig(r.cfg))
+	if err != nil {
+		return fmt.Errorf("consumer %s: subscribe: %w", r.cfg.Name, err)
+	}
+	defer func() { _ = sub.Close() }()
+
+	r.log.Infof("consumer: listening on %v (durable=%s, handlers=%v, concurrency=%d, ordering_key=%s)",
+		r.cfg.Subjects, r.cfg.Durable, r.handlers, r.cfg.Concurrency, r.cfg.OrderingKey)
+
+	inflight := r.cfg.MaxAckPending
+	if inflight <= 0 {
+		inflight = r.cfg.Concurrency * r.cfg.BatchSize
+	}
+	pool := newPool(r.cfg.Concurrency, inflight, r.orderingKey, func(d broker.Delivery) {
+		r.process(work, d)
+	})
+	defer pool.drain()
+
+	for {
+		n := pool.reserve(ctx, r.cfg.BatchSize)
+		if n == 0 {
+			return nil
+		}
+		fetchCtx, cancel := context.WithTimeout(ctx, r.cfg.FetchWait)
+		msgs, err := sub.Fetch(fetchCtx, n)
+		cancel()
+		pool.unreserve(n - len(msgs))
+		if err != nil && ctx.Err() == nil && !errors.Is(err, broker.ErrTimeout) {
+			r.log.WithError(err).Warn("consumer: fetch failed")
+		}
+		for _, msg := range msgs {
+			pool.submit(msg)
+		}
+		r.seen.prune(time.Now().Add(-r.redeliveryHorizon()))
+	}
+}
+
+// orderingKey returns the header value that serializes msg with others of
+// the same key, or "" when it may run on any lane.
+func (r *Runtime) orderingKey(d broker.Delivery) string {
+	if r.cfg.OrderingKey == "" || r.cfg.OrderingKey == "none" {
+		return ""
+	}
+	return d.Headers()[r.cfg.OrderingKey]
+}
+
+// redeliveryHorizon bounds how long a message can keep being redelivered.
+func (r *Runtime) redeliveryHorizon() time.Duration {
+	wait := r.cfg.AckWait
+	for _, b := range r.cfg.Backoff {
+		wait = max(wait, b)
+	}
+	maxDeliver := r.cfg.MaxDeliver
+	if maxDeliver <= 0 {
+		maxDeliver = 10
+	}
+	return max(wait, time.Minute) * time.Duration(maxDeliver) * 2
+}
+
+func (r *Runtime) process(ctx context.Context, raw broker.Delivery) {
+	msg, decodeErr := toMessage(raw)
+	if r.verifier != nil {
+		signed, err := r.verifier.Verify(raw.Subject(), raw.Data(), raw.Headers())
+		switch {
+		case err != nil:
+			decodeErr = err
+		case signed != nil:
+			msg.Headers = signedHeaders(msg.Headers, signed)
+		}
+	}
+	entry := r.log.WithFields(logrus.Fields{
+		"subject":       msg.Subject,
+		"event_id":      msg.Headers[outbox.HeaderEventID],
+		"request_id":    msg.Headers[outbox.HeaderRequestID],
+		"traceparent":   msg.Headers[outbox.HeaderTraceParent],
+		"claimed_actor": msg.Headers[outbox.HeaderClaimedActor],
+		"delivered":     msg.NumDelivered,
+	})
+	if ctx.Err() != nil {
+		entry.Debug("consumer: shutting down, nak")
+		_ = raw.Nak(0)
+		return
+	}
+	if msg.Sequence > 0 {
+		r.seen.seen(msg, time.Now())
+	}
+
+	handler, ok := r.registry.Match(r.handlers, msg.Subject)
+	var (
+		duplicate bool
+		err       error
+	)
+	switch {
+	case decodeErr != nil:
+		err = Permanent(decodeErr)
+	case !ok:
+		err = ErrNoHandler
+	default:
+		err = r.runHandler(ctx, raw, handler, func(ctx context.Context) error {
+			if r.inbox == nil || msg.Sequence == 0 {
+				return handler.Func(ctx, msg)
+			}
+			var err error
+			duplicate, err = r.inbox.Process(ctx, entity.ConsumerInbox{
+				Consumer:  r.cfg.Durable,
+				MessageID: inboxID(msg),
+				Stream:    msg.Stream,
+				Sequence:  msg.Sequence,
+				Subject:   msg.Subject,
+			}, func(ctx context.Context) error {
+				return handler.Func(ctx, msg)
+			})
+			return err
+		})
+	}
+	if err != nil && ctx.Err() != nil {
+		entry.WithError(err).Warn("consumer: grace period over, nak")
+		_ = raw.Nak(0)
+		return
+	}
+	if err != nil {
+		entry.WithError(err).Warn("consumer: handler failed")
+		r.handleError(ctx, raw, msg, handler.Name, err, entry)
+		return
+	}
+	r.seen.forget(msg.Sequence)
+	if err := raw.Ack(); err != nil {
+		entry.WithError(err).Warn("consumer: ack failed")
+		return
+	}
+	if duplicate {
+		entry.WithField("handler", handler.Name).Info("consumer: duplicate acked")
+		return
+	}
+	entry.WithField("handler", handler.Name).Info("consumer: message handled")
+}
+
+// runHandler runs fn under the handler's max processing time and sends
+// InProgress every half ack_wait meanwhile, so JetStream does not redeliver
+// a message that is still being worked on. An overrun cancels fn's context
+// and fails the attempt.
+func (r *Runtime) runHandler(ctx context.Context, raw broker.Delivery, h Handler, fn func(ctx context.Context) error) error {
+	limit := h.MaxProcessingTime
+	if limit <= 0 {
+		limit = r.cfg.MaxProcessingTime
+	}
+	hctx, cancel := ctx, context.CancelFunc(func() {})
+	if limit > 0 {
+		hctx, cancel = context.WithTimeout(ctx, limit)
+	}
+	defer cancel()
+
+	done := make(chan struct{})
+	go r.heartbeat(hctx, raw, done)
+	err := fn(hctx)
+	close(done)
+
+	if limit > 0 && ctx.Err() == nil && errors.Is(hctx.Err(), context.DeadlineExceeded) {
+		if err != nil {
+			return fmt.Errorf("%w (%s): %v", ErrProcessingTimeout, limit, err)
+		}
+		return fmt.Errorf("%w (%s)", ErrProcessingTimeout, limit)
+	}
+	return err
+}
+
+func (r *Runtime) heartbeat(ctx context.Context, raw broker.Delivery, done <-chan struct{}) {
+	interval := r.cfg.AckWait / 2
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := raw.InProgress(); err != nil {
+				r.log.WithError(err).Debug("consumer: in-progress heartbeat failed")
+			}
+		}
+	}
+}
+
+// signedHeaders drops the headers a signature does not cover, so headers
+// added after publishing cannot pass as the producer's. Nats-Msg-Id is kept
+// for the inbox and the key ID for audit.
+func signedHeaders(headers map[string]string, signed []string) map[string]string {
+	kept := make(map[string]string, len(signed)+2)
+	for _, name := range append([]string{broker.HeaderMsgID, signing.HeaderKeyID}, signed...) {
+		if v, ok := headers[name]; ok {
+			kept[name] = v
+		}
+	}
+	return kept
+}
+
+// inboxID prefers the publisher's Nats-Msg-Id, which survives republishing,
+// and falls back to the stream sequence.
+func inboxID(msg Message) string {
+	if id := msg.Headers[broker.HeaderMsgID]; id != "" {
+		return id
+	}
+	return fmt.Sprintf("%s:%d", msg.Stream, msg.Sequence)
+}
+
+func (r *Runtime) handleError(ctx context.Context, raw broker.Delivery, msg Message, handler string, err error, log logrus.FieldLogger) {
+	if msg.Sequence == 0 {
+		log.Warn("consumer: metadata missing")
+		_ = raw.Nak(0)
+		return
+	}
+	maxDeliver := r.cfg.MaxDeliver
+	if maxDeliver <= 0 {
+		maxDeliver = 10
+	}
+	reason := ""
+	switch {
+	case errors.Is(err, ErrNoHandler):
+		reason = ReasonNoHandler
+	case errors.Is(err, signing.ErrSignature):
+		reason = ReasonSignature
+	case IsPermanent(err):
+		reason = ReasonPermanent
+	case int(msg.NumDelivered) >= maxDeliver:
+		reason = ReasonMaxDeliver
+	}
+	if reason != "" {
+		r.deadLetter(ctx, raw, msg, DeadLetter{
+			Subject:          msg.Subject,
+			Stream:           msg.Stream,
+			Sequence:         msg.Sequence,
+			MsgID:            msg.Headers[broker.HeaderMsgID],
+			Consumer:         r.cfg.Durable,
+			Handler:          handler,
+			Delivered:        msg.NumDelivered,
+			PublishedAt:      msg.Timestamp,
+			FirstDeliveredAt: r.seen.seen(msg, time.Now()),
+			FailedAt:         time.Now(),
+			Reason:           reason,
+			Error:            err.Error(),
+		}, log)
+		return
+	}
+	_ = raw.Nak(backoffForAttempt(r.cfg.Backoff, msg.NumDelivered))
+}
+
+// deadLetter publishes the original payload and headers to the DLQ subject
+// with the failure context added as envelope headers.
+func (r *Runtime) deadLetter(ctx context.Context, raw broker.Delivery, msg Message, dl DeadLetter, log logrus.FieldLogger) {
+	if r.cfg.DLQSubject == "" {
+		log.Warn("consumer: dlq subject not configured")
+		r.seen.forget(msg.Sequence)
+		_ = raw.Term()
+		return
+	}
+	// msg.Headers may have been rewritten by toMessage; the DLQ keeps the
+	// original body, so it keeps the original headers too.
+	original := raw.Headers()
+	headers := make(map[string]string, len(original)+12)
+	for k, v := range original {
+		if k != broker.HeaderMsgID {
+			headers[k] = v
+		}
+	}
+	for k, v := range dl.Headers() {
+		headers[k] = v
+	}
+	msgID := fmt.Sprintf("dlq-%s-%s-%d", r.cfg.Durable, msg.Stream, msg.Sequence)
+	if err := r.publisher.Publish(ctx, r.cfg.DLQSubject, raw.Data(), msgID, headers); err != nil {
+		log.WithError(err).Warn("consumer: dlq publish failed")
+		_ = raw.Nak(0)
+		return
+	}
+	r.seen.forget(msg.Sequence)
+	log.WithField("reason", dl.Reason).Warn("consumer: message dead-lettered")
+	_ = raw.Ack()
+}
+
+// SubscriptionConfig is the broker-level part of cfg.
+func SubscriptionConfig(cfg config.Consumer) broker.SubscriptionConfig {
+	return broker.SubscriptionConfig{
+		Durable:       cfg.Durable,
+		Subjects:      cfg.Subjects,
+		AckWait:       cfg.AckWait,
+		MaxAckPending: cfg.MaxAckPending,
+		MaxDeliver:    cfg.MaxDeliver,
+		Backoff:       cfg.Backoff,
+	}
+}
+
+// toMessage unwraps the CloudEvents envelope when there is one, checks the
+// payload against its event contract and upcasts it to the latest version.
+// A broken envelope or a payload that breaks the contract is returned as an
+// error next to the raw message.
+func toMessage(d broker.Delivery) (Message, error) {
+	msg := Message{
+		Subject: d.Subject(),
+		Data:    d.Data(),
+		Headers: d.Headers(),
+	}
+	if md, err := d.Metadata(); err == nil {
+		msg.Stream = md.Stream
+		msg.Sequence = md.Sequence
+		msg.NumDelivered = md.NumDelivered
+		msg.Timestamp = md.Timestamp
+	}
+	event, ok, err := cloudevents.Decode(msg.Data, msg.Headers)
+	if err != nil {
+		return msg, err
+	}
+	eventType := msg.Headers[outbox.HeaderEventType]
+	contentType := msg.Headers[cloudevents.HeaderContentType]
+	if ok {
+		msg.Event = &event
+		msg.Data = event.Data
+		eventType = event.Type
+		contentType = event.DataContentType
+	}
+	version, err := events.ParseVersion(msg.Headers[outbox.HeaderSchemaVersion])
+	if err != nil {
+		return msg, err
+	}
+	// Handlers always see JSON, whatever the wire encoding was.
+	if contentType == events.ContentTypeProtobuf {
+		data, err := events.FromProto(eventType, version, msg.Data)
+		if err != nil {
+			return msg, err
+		}
+		msg.Data = data
+		if msg.Event != nil {
+			msg.Event.Data = data
+			msg.Event.DataContentType = cloudevents.ContentTypeJSON
+		} else {
+			msg.Headers[cloudevents.HeaderContentType] = cloudevents.ContentTypeJSON
+		}
+	}
+	if err := events.Validate(eventType, version, msg.Data); err != nil {
+		return msg, err
+	}
+	data, latest, err := events.Upcast(eventType, version, msg.Data)
+	if err != nil {
+		return msg, err
+	}
+	if latest != version {
+		msg.Data = data
+		msg.Headers[outbox.HeaderSchemaVersion] = strconv.Itoa(latest)
+		if msg.Event != nil {
+			msg.Event.Data = data
+		}
+	}
+	return msg, nil
+}
+
+func backoffForAttempt(backoff []time.Duration, delivered uint64) time.Duration {
+	if len(backoff) == 0 {
+		return 0
+	}
+	idx := int(delivered) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(backoff) {
+		idx = len(backoff) - 1
+	}
+	return backoff[idx]
+}
@@ -0,0 +1,235 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/consumer"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/signing"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/messaging"
+	"github.com/sirupsen/logrus"
+)
+
+// A transient failure is retried until the handler succeeds, and a
+// permanent one is dead-lettered with the original payload and the
+// failure context.
+func TestRuntimeRetriesAndDeadLetters(t *testing.T) {
+	mem := messaging.NewMemoryBroker()
+	mem.AddStream("orders", []string{"orders.>"})
+	mem.AddStream("dlq", []string{"dlq.>"})
+
+	var (
+		mu       sync.Mutex
+		attempts = map[string]int{}
+		handled  = map[string]uint64{}
+	)
+	registry := consumer.NewRegistry()
+	registry.Handle("orders", "orders.*", func(ctx context.Context, msg consumer.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[msg.Subject]++
+		switch {
+		case msg.Subject == "orders.rejected":
+			return consumer.Permanent(errors.New("order rejected"))
+		case attempts[msg.Subject] == 1:
+			return errors.New("temporarily unavailable")
+		}
+		handled[msg.Subject] = msg.NumDelivered
+		return nil
+	})
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	rt := consumer.NewRuntime(mem.Subscriber("orders"), mem, nil, config.Consumer{
+		Name:        "orders",
+		Durable:     "orders",
+		Subjects:    []string{"orders.>"},
+		Handlers:    []string{"orders"},
+		Concurrency: 1,
+		BatchSize:   10,
+		FetchWait:   20 * time.Millisecond,
+		AckWait:     time.Second,
+		MaxDeliver:  3,
+		DLQSubject:  "dlq.orders",
+	}, registry, log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- rt.Run(ctx, context.Background()) }()
+
+	for _, subject := range []string{"orders.placed", "orders.rejected"} {
+		if err := mem.Publish(ctx, subject, []byte(`{"id":1}`), subject, map[string]string{"X-Test": "kept"}); err != nil {
+			t.Fatalf("publish %s: %v", subject, err)
+		}
+	}
+
+	dlqSub, err := mem.Subscriber("dlq").Subscribe(ctx, broker.SubscriptionConfig{Durable: "inspect"})
+	if err != nil {
+		t.Fatalf("subscribe dlq: %v", err)
+	}
+	fetchCtx, fetchCancel := context.WithTimeout(ctx, 2*time.Second)
+	dead, err := dlqSub.Fetch(fetchCtx, 1)
+	fetchCancel()
+	if err != nil {
+		t.Fatalf("no dead letter: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		delivered, ok := handled["orders.placed"]
+		mu.Unlock()
+		if ok {
+			if delivered != 2 {
+				t.Errorf("orders.placed handled on delivery %d, want 2", delivered)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("orders.placed was not handled after the retry")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	dl := consumer.ParseDeadLetter(dead[0].Headers())
+	if dl.Subject != "orders.rejected" || dl.Reason != consumer.ReasonPermanent || dl.Delivered != 1 {
+		t.Errorf("dead letter = %+v, want orders.rejected, %s, delivered 1", dl, consumer.ReasonPermanent)
+	}
+	if got := string(dead[0].Data()); got != `{"id":1}` {
+		t.Errorf("dead letter payload = %s", got)
+	}
+	if got := dead[0].Headers()["X-Test"]; got != "kept" {
+		t.Errorf("dead letter lost the original headers: X-Test = %q", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts["orders.rejected"] != 1 {
+		t.Errorf("permanent failure retried: %d attempts", attempts["orders.rejected"])
+	}
+}
+
+// With signatures required, unsigned and tampered messages are dead-lettered
+// without reaching a handler, and handlers only see covered headers.
+func TestRuntimeDeadLettersBadSignatures(t *testing.T) {
+	private, public, err := signing.GenerateKey(signing.AlgorithmHMACSHA256)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	signKey, err := signing.ParseKey("k1", private)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	verifyKey, _ := signing.ParseKey("k1", public)
+	signer, _ := signing.NewSigner(signKey)
+	verifier, err := signing.NewVerifier(true, verifyKey)
+	if err != nil {
+		t.Fatalf("verifier: %v", err)
+	}
+
+	mem := messaging.NewMemoryBroker()
+	mem.AddStream("orders", []string{"orders.>"})
+	mem.AddStream("dlq", []string{"dlq.>"})
+
+	var (
+		mu      sync.Mutex
+		handled = map[string]map[string]string{}
+	)
+	registry := consumer.NewRegistry()
+	registry.Handle("orders", "orders.*", func(ctx context.Context, msg consumer.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[msg.Subject] = msg.Headers
+		return nil
+	})
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	rt := consumer.NewRuntime(mem.Subscriber("orders"), mem, nil, config.Consumer{
+		Name:        "orders",
+		Durable:     "orders",
+		Subjects:    []string{"orders.>"},
+		Handlers:    []string{"orders"},
+		Concurrency: 1,
+		BatchSize:   10,
+		FetchWait:   20 * time.Millisecond,
+		AckWait:     time.Second,
+		DLQSubject:  "dlq.orders",
+	}, registry, log)
+	rt.VerifySignatures(verifier)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- rt.Run(ctx, context.Background()) }()
+
+	signed := func(subject string) map[string]string {
+		headers := map[string]string{"X-Test": "signed"}
+		signer.Sign(subject, []byte(`{"id":1}`), headers)
+		return headers
+	}
+	valid := signed("orders.placed")
+	valid["X-Added-Later"] = "forged"
+	tampered := signed("orders.tampered")
+	tampered["X-Test"] = "changed"
+	for subject, headers := range map[string]map[string]string{
+		"orders.placed":   valid,
+		"orders.unsigned": {"X-Test": "unsigned"},
+		"orders.tampered": tampered,
+	} {
+		if err := mem.Publish(ctx, subject, []byte(`{"id":1}`), subject, headers); err != nil {
+			t.Fatalf("publish %s: %v", subject, err)
+		}
+	}
+
+	dlqSub, err := mem.Subscriber("dlq").Subscribe(ctx, broker.SubscriptionConfig{Durable: "inspect"})
+	if err != nil {
+		t.Fatalf("subscribe dlq: %v", err)
+	}
+	var dead []broker.Delivery
+	deadline := time.Now().Add(2 * time.Second)
+	placed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		_, ok := handled["orders.placed"]
+		return ok
+	}
+	for (len(dead) < 2 || !placed()) && time.Now().Before(deadline) {
+		fetchCtx, fetchCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		batch, _ := dlqSub.Fetch(fetchCtx, 2)
+		fetchCancel()
+		dead = append(dead, batch...)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	reasons := map[string]string{}
+	for _, d := range dead {
+		dl := consumer.ParseDeadLetter(d.Headers())
+		reasons[dl.Subject] = dl.Reason
+	}
+	want := map[string]string{"orders.unsigned": consumer.ReasonSignature, "orders.tampered": consumer.ReasonSignature}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("dead letters %v, want %v", reasons, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	headers, ok := handled["orders.placed"]
+	if !ok || len(handled) != 1 {
+		t.Fatalf("handled %v, want only orders.placed", handled)
+	}
+	if headers["X-Test"] != "signed" || headers["X-Added-Later"] != "" {
+		t.Errorf("handler headers %v, want only the signed ones", headers)
+	}
+}
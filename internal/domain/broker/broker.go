@@ -0,0 +1,90 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// HeaderMsgID carries the deduplication ID. Every backend uses the
+// JetStream header name so IDs survive a move between brokers.
+const HeaderMsgID = "Nats-Msg-Id"
+
+var (
+	// ErrTimeout is returned by Subscription.Fetch when nothing arrived in time.
+	ErrTimeout = errors.New("broker: fetch timeout")
+	// ErrNoStream is returned by Publish when no stream captures the
+	// subject, so the message could never be stored.
+	ErrNoStream = errors.New("broker: no stream captures subject")
+)
+
+// Publisher appends a message to the stream that captures subject. A
+// non-empty msgID deduplicates republishes of the same message.
+type Publisher interface {
+	Publish(ctx context.Context, subject string, payload []byte, msgID string, headers map[string]string) error
+}
+
+// Subscriber opens durable pull subscriptions. Subscribing again to the
+// same durable resumes its delivery state.
+type Subscriber interface {
+	Subscribe(ctx context.Context, cfg SubscriptionConfig) (Subscription, error)
+}
+
+type SubscriptionConfig struct {
+	Durable       string
+	Subjects      []string
+	AckWait       time.Duration
+	MaxAckPending int
+	MaxDeliver    int
+	Backoff       []time.Duration
+}
+
+type Subscription interface {
+	// Fetch waits until at least one message is available or ctx ends, and
+	// returns up to n. It returns ErrTimeout when ctx's deadline passes
+	// first.
+	Fetch(ctx context.Context, n int) ([]Delivery, error)
+	Close() error
+}
+
+// Metadata describes one delivery of a stored message.
+type Metadata struct {
+	Stream       string
+	Sequence     uint64
+	NumDelivered uint64
+	Timestamp    time.Time
+}
+
+// Delivery is a message handed to a subscriber. Exactly one of Ack, Nak
+// and Term settles it; until then it is redelivered after the ack wait,
+// which InProgress restarts.
+type Delivery interface {
+	Subject() string
+	Data() []byte
+	Headers() map[string]string
+	Metadata() (Metadata, error)
+	Ack() error
+	Nak(delay time.Duration) error
+	Term() error
+	InProgress() error
+}
+
+// SubjectMatches reports whether subject matches pattern, where "*"
+// matches one token and ">" matches the remaining tokens.
+func SubjectMatches(pattern, subject string) bool {
+	pt := strings.Split(pattern, ".")
+	st := strings.Split(subject, ".")
+	for i, token := range pt {
+		if token == ">" {
+			return len(st) > i
+		}
+		if i >= len(st) {
+			return false
+		}
+		if token != "*" && token != st[i] {
+			return false
+		}
+	}
+	return len(pt) == len(st)
+}
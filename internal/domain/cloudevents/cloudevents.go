@@ -0,0 +1,214 @@
+// Package cloudevents encodes events as CloudEvents 1.0 in either the
+// binary content mode, with attributes in ce-* headers, or the structured
+// JSON mode.
+package cloudevents
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	SpecVersion = "1.0"
+
+	ModeBinary     = "binary"
+	ModeStructured = "structured"
+
+	ContentTypeJSON       = "application/json"
+	ContentTypeStructured = "application/cloudevents+json"
+
+	HeaderContentType = "Content-Type"
+	HeaderPrefix      = "ce-"
+)
+
+var ErrInvalid = errors.New("cloudevents: invalid event")
+
+// Event holds the context attributes and data of one CloudEvent.
+type Event struct {
+	ID              string
+	Source          string
+	SpecVersion     string
+	Type            string
+	Subject         string
+	Time            time.Time
+	DataSchema      string
+	DataContentType string
+	Data            []byte
+}
+
+// Validate checks the attributes the spec requires.
+func (e Event) Validate() error {
+	var missing []string
+	for _, attr := range [][2]string{{"id", e.ID}, {"source", e.Source}, {"specversion", e.SpecVersion}, {"type", e.Type}} {
+		if attr[1] == "" {
+			missing = append(missing, attr[0])
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrInvalid, strings.Join(missing, ", "))
+	}
+	if e.SpecVersion != SpecVersion {
+		return fmt.Errorf("%w: unsupported specversion %q", ErrInvalid, e.SpecVersion)
+	}
+	return nil
+}
+
+// Encode renders e in mode and returns the message body and the headers to
+// add to it.
+func Encode(e Event, mode string) ([]byte, map[string]string, error) {
+	if e.SpecVersion == "" {
+		e.SpecVersion = SpecVersion
+	}
+	if err := e.Validate(); err != nil {
+		return nil, nil, err
+	}
+	switch mode {
+	case ModeBinary, "":
+		return e.Data, binaryHeaders(e), nil
+	case ModeStructured:
+		data, err := json.Marshal(toStructured(e))
+		if err != nil {
+			return nil, nil, err
+		}
+		return data, map[string]string{HeaderContentType: ContentTypeStructured}, nil
+	default:
+		return nil, nil, fmt.Errorf("cloudevents: unknown mode %q", mode)
+	}
+}
+
+// Decode reads a CloudEvent in either mode. ok is false when the message
+// carries no envelope at all.
+func Decode(data []byte, headers map[string]string) (e Event, ok bool, err error) {
+	if strings.HasPrefix(header(headers, HeaderContentType), ContentTypeStructured) {
+		var s structured
+		if err := json.Unmarshal(data, &s); err != nil {
+			return Event{}, true, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		e, err = fromStructured(s)
+		if err != nil {
+			return Event{}, true, err
+		}
+		return e, true, e.Validate()
+	}
+	if header(headers, HeaderPrefix+"specversion") == "" {
+		return Event{}, false, nil
+	}
+	e = Event{
+		ID:              header(headers, HeaderPrefix+"id"),
+		Source:          header(headers, HeaderPrefix+"source"),
+		SpecVersion:     header(headers, HeaderPrefix+"specversion"),
+		Type:            header(headers, HeaderPrefix+"type"),
+		Subject:         header(headers, HeaderPrefix+"subject"),
+		DataSchema:      header(headers, HeaderPrefix+"dataschema"),
+		DataContentType: header(headers, HeaderContentType),
+		Data:            data,
+	}
+	if t := header(headers, HeaderPrefix+"time"); t != "" {
+		if e.Time, err = time.Parse(time.RFC3339Nano, t); err != nil {
+			return Event{}, true, fmt.Errorf("%w: time: %v", ErrInvalid, err)
+		}
+	}
+	return e, true, e.Validate()
+}
+
+func binaryHeaders(e Event) map[string]string {
+	headers := map[string]string{
+		HeaderPrefix + "specversion": e.SpecVersion,
+		HeaderPrefix + "id":          e.ID,
+		HeaderPrefix + "source":      e.Source,
+		HeaderPrefix + "type":        e.Type,
+	}
+	if e.Subject != "" {
+		headers[HeaderPrefix+"subject"] = e.Subject
+	}
+	if !e.Time.IsZero() {
+		headers[HeaderPrefix+"time"] = e.Time.UTC().Format(time.RFC3339Nano)
+	}
+	if e.DataSchema != "" {
+		headers[HeaderPrefix+"dataschema"] = e.DataSchema
+	}
+	if e.DataContentType != "" {
+		headers[HeaderContentType] = e.DataContentType
+	}
+	return headers
+}
+
+// header looks name up case-insensitively; NATS keeps header names as sent.
+func header(headers map[string]string, name string) string {
+	if v, ok := headers[name]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+type structured struct {
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	SpecVersion     string          `json:"specversion"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            *time.Time      `json:"time,omitempty"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+func toStructured(e Event) structured {
+	s := structured{
+		ID:              e.ID,
+		Source:          e.Source,
+		SpecVersion:     e.SpecVersion,
+		Type:            e.Type,
+		Subject:         e.Subject,
+		DataSchema:      e.DataSchema,
+		DataContentType: e.DataContentType,
+	}
+	if !e.Time.IsZero() {
+		t := e.Time.UTC()
+		s.Time = &t
+	}
+	if isJSON(e.DataContentType) && json.Valid(e.Data) {
+		s.Data = e.Data
+	} else if len(e.Data) > 0 {
+		s.DataBase64 = base64.StdEncoding.EncodeToString(e.Data)
+	}
+	return s
+}
+
+func fromStructured(s structured) (Event, error) {
+	e := Event{
+		ID:              s.ID,
+		Source:          s.Source,
+		SpecVersion:     s.SpecVersion,
+		Type:            s.Type,
+		Subject:         s.Subject,
+		DataSchema:      s.DataSchema,
+		DataContentType: s.DataContentType,
+		Data:            []byte(s.Data),
+	}
+	if s.Time != nil {
+		e.Time = *s.Time
+	}
+	if s.DataBase64 != "" {
+		data, err := base64.StdEncoding.DecodeString(s.DataBase64)
+		if err != nil {
+			return Event{}, fmt.Errorf("%w: data_base64: %v", ErrInvalid, err)
+		}
+		e.Data = data
+	}
+	return e, nil
+}
+
+func isJSON(contentType string) bool {
+	return contentType == "" || strings.HasPrefix(contentType, ContentTypeJSON) || strings.HasSuffix(strings.SplitN(contentType, ";", 2)[0], "+json")
+}
@@ -0,0 +1,172 @@
+package cloudevents_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/cloudevents"
+)
+
+func sampleEvent() cloudevents.Event {
+	return cloudevents.Event{
+		ID:              "0b6f1c9e-8d2a-4b8e-9f6c-1f0c3a4d5e6f",
+		Source:          "/users",
+		SpecVersion:     cloudevents.SpecVersion,
+		Type:            "user.created",
+		Subject:         "7d3c9f2e-1a2b-4c3d-8e9f-0a1b2c3d4e5f",
+		Time:            time.Date(2026, 1, 2, 15, 4, 5, 123000000, time.UTC),
+		DataSchema:      "https://example.com/schemas/user.created/v1.json",
+		DataContentType: cloudevents.ContentTypeJSON,
+		Data:            []byte(`{"email":"a@example.com","name":"A"}`),
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	binary := sampleEvent()
+	protobuf := sampleEvent()
+	protobuf.DataContentType, protobuf.Data = "application/protobuf", []byte{0x0a, 0x01, 0xff}
+	minimal := cloudevents.Event{ID: "1", Source: "/users", SpecVersion: cloudevents.SpecVersion, Type: "user.deleted"}
+
+	tests := []struct {
+		name  string
+		mode  string
+		event cloudevents.Event
+	}{
+		{name: "binary", mode: cloudevents.ModeBinary, event: binary},
+		{name: "binary minimal", mode: cloudevents.ModeBinary, event: minimal},
+		{name: "structured json data", mode: cloudevents.ModeStructured, event: binary},
+		{name: "structured base64 data", mode: cloudevents.ModeStructured, event: protobuf},
+		{name: "structured minimal", mode: cloudevents.ModeStructured, event: minimal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, headers, err := cloudevents.Encode(tt.event, tt.mode)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			got, ok, err := cloudevents.Decode(body, headers)
+			if err != nil || !ok {
+				t.Fatalf("decode = %t, %v", ok, err)
+			}
+			if !got.Time.Equal(tt.event.Time) {
+				t.Fatalf("time = %s, want %s", got.Time, tt.event.Time)
+			}
+			got.Time = tt.event.Time
+			if len(got.Data) == 0 && len(tt.event.Data) == 0 {
+				got.Data = tt.event.Data
+			}
+			if !reflect.DeepEqual(got, tt.event) {
+				t.Fatalf("decoded %+v\nwant    %+v", got, tt.event)
+			}
+		})
+	}
+}
+
+func TestEncodeModes(t *testing.T) {
+	e := sampleEvent()
+	body, headers, err := cloudevents.Encode(e, cloudevents.ModeBinary)
+	if err != nil {
+		t.Fatalf("binary: %v", err)
+	}
+	if string(body) != string(e.Data) || headers["ce-type"] != e.Type || headers["Content-Type"] != cloudevents.ContentTypeJSON {
+		t.Fatalf("binary body %s headers %v", body, headers)
+	}
+
+	body, headers, err = cloudevents.Encode(e, cloudevents.ModeStructured)
+	if err != nil {
+		t.Fatalf("structured: %v", err)
+	}
+	if headers["Content-Type"] != cloudevents.ContentTypeStructured || len(headers) != 1 {
+		t.Fatalf("structured headers %v", headers)
+	}
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatalf("structured body: %v", err)
+	}
+	if string(envelope["data"]) != string(e.Data) {
+		t.Fatalf("json data should be embedded as is, got %s", envelope["data"])
+	}
+
+	if _, _, err := cloudevents.Encode(e, "batched"); err == nil {
+		t.Fatal("unknown mode accepted")
+	}
+}
+
+func TestMissingRequiredAttributes(t *testing.T) {
+	tests := []struct {
+		attr   string
+		header string
+		clear  func(*cloudevents.Event)
+	}{
+		{attr: "id", header: "ce-id", clear: func(e *cloudevents.Event) { e.ID = "" }},
+		{attr: "source", header: "ce-source", clear: func(e *cloudevents.Event) { e.Source = "" }},
+		{attr: "type", header: "ce-type", clear: func(e *cloudevents.Event) { e.Type = "" }},
+		{attr: "specversion", clear: func(e *cloudevents.Event) { e.SpecVersion = "" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.attr, func(t *testing.T) {
+			e := sampleEvent()
+			tt.clear(&e)
+			if err := e.Validate(); !errors.Is(err, cloudevents.ErrInvalid) || !strings.Contains(err.Error(), tt.attr) {
+				t.Fatalf("validate = %v, want missing %s", err, tt.attr)
+			}
+			if tt.header == "" {
+				return
+			}
+			if _, _, err := cloudevents.Encode(e, cloudevents.ModeBinary); !errors.Is(err, cloudevents.ErrInvalid) {
+				t.Fatalf("encode = %v, want ErrInvalid", err)
+			}
+
+			body, headers, err := cloudevents.Encode(sampleEvent(), cloudevents.ModeBinary)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			delete(headers, tt.header)
+			if _, ok, err := cloudevents.Decode(body, headers); !ok || !errors.Is(err, cloudevents.ErrInvalid) {
+				t.Fatalf("binary decode = %t, %v; want ErrInvalid", ok, err)
+			}
+
+			body, headers, err = cloudevents.Encode(sampleEvent(), cloudevents.ModeStructured)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			var envelope map[string]json.RawMessage
+			if err := json.Unmarshal(body, &envelope); err != nil {
+				t.Fatal(err)
+			}
+			delete(envelope, tt.attr)
+			body, _ = json.Marshal(envelope)
+			if _, ok, err := cloudevents.Decode(body, headers); !ok || !errors.Is(err, cloudevents.ErrInvalid) {
+				t.Fatalf("structured decode = %t, %v; want ErrInvalid", ok, err)
+			}
+		})
+	}
+}
+
+// Encode fills in the default specversion, so a missing one only shows up
+// in what is received.
+func TestDecodeSpecVersion(t *testing.T) {
+	body, headers, err := cloudevents.Encode(sampleEvent(), cloudevents.ModeBinary)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	delete(headers, "ce-specversion")
+	if _, ok, err := cloudevents.Decode(body, headers); ok || err != nil {
+		t.Fatalf("without ce-specversion = %t, %v; want a plain message", ok, err)
+	}
+
+	headers["ce-specversion"] = "0.3"
+	if _, _, err := cloudevents.Decode(body, headers); !errors.Is(err, cloudevents.ErrInvalid) {
+		t.Fatalf("specversion 0.3 = %v, want ErrInvalid", err)
+	}
+
+	structured := `{"id":"1","source":"/users","type":"user.created","data":{}}`
+	_, ok, err := cloudevents.Decode([]byte(structured), map[string]string{"content-type": cloudevents.ContentTypeStructured})
+	if !ok || !errors.Is(err, cloudevents.ErrInvalid) || !strings.Contains(err.Error(), "specversion") {
+		t.Fatalf("structured without specversion = %t, %v; want missing specversion", ok, err)
+	}
+}
@@ -8,10 +8,15 @@ import (
 )
 
 type AuditLog struct {
-	ID        uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
-	EventType string         `gorm:"not null"`
-	Payload   datatypes.JSON `gorm:"type:jsonb;not null"`
-	CreatedAt time.Time      `gorm:"not null"`
+	ID          uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	EventType   string         `gorm:"not null"`
+	Payload     datatypes.JSON `gorm:"type:jsonb;not null"`
+	RequestID   string         `gorm:"default:null"`
+	TraceParent string         `gorm:"column:traceparent;default:null"`
+	// ClaimedActor is the unauthenticated X-Actor of the originating request.
+	ClaimedActor string         `gorm:"default:null"`
+	Headers      datatypes.JSON `gorm:"type:jsonb;not null;default:'{}'"`
+	CreatedAt    time.Time      `gorm:"not null"`
 }
 
 func (AuditLog) TableName() string {
@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+type ConsumerInbox struct {
+	Consumer    string    `gorm:"primaryKey"`
+	MessageID   string    `gorm:"primaryKey"`
+	Stream      string    `gorm:"not null"`
+	Sequence    uint64    `gorm:"not null"`
+	Subject     string    `gorm:"not null"`
+	ProcessedAt time.Time `gorm:"not null;default:now()"`
+}
+
+func (ConsumerInbox) TableName() string {
+	return "consumer_inbox"
+}
@@ -0,0 +1,31 @@
+package entity
+
+import "github.com/google/uuid"
+
+// DomainEvent is something that happened to an aggregate. The persistence
+// layer drains recorded events into the outbox in the same transaction that
+// stores the aggregate.
+type DomainEvent interface {
+	AggregateType() string
+	AggregateID() uuid.UUID
+	EventType() string
+}
+
+type EventRecorder interface {
+	PullEvents() []DomainEvent
+}
+
+// Events is embedded by aggregates to record domain events.
+type Events struct {
+	pending []DomainEvent
+}
+
+func (e *Events) Record(event DomainEvent) {
+	e.pending = append(e.pending, event)
+}
+
+func (e *Events) PullEvents() []DomainEvent {
+	events := e.pending
+	e.pending = nil
+	return events
+}
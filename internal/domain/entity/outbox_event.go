@@ -12,12 +12,18 @@ type OutboxEvent struct {
 	AggregateType string         `gorm:"not null"`
 	AggregateID   uuid.UUID      `gorm:"type:uuid;not null"`
 	EventType     string         `gorm:"not null"`
-	Payload       datatypes.JSON `gorm:"type:jsonb;not null"`
-	CreatedAt     time.Time      `gorm:"not null"`
-	LockedAt      *time.Time     `gorm:""`
-	ProcessedAt   *time.Time     `gorm:""`
-	Attempts      int            `gorm:"not null;default:0"`
-	LastError     string         `gorm:""`
+	Payload       datatypes.JSON `gorm:"type:jsonb"`
+	// PayloadRaw holds the protobuf encoding instead of Payload when the
+	// outbox stores raw payloads.
+	PayloadRaw  []byte         `gorm:"type:bytea"`
+	Headers     datatypes.JSON `gorm:"type:jsonb;not null;default:'{}'"`
+	CreatedAt   time.Time      `gorm:"not null"`
+	AvailableAt time.Time      `gorm:"not null;default:now()"`
+	CancelledAt *time.Time     `gorm:""`
+	LockedAt    *time.Time     `gorm:""`
+	ProcessedAt *time.Time     `gorm:""`
+	Attempts    int            `gorm:"not null;default:0"`
+	LastError   string         `gorm:""`
 }
 
 func (OutboxEvent) TableName() string {
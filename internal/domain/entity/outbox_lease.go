@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+type OutboxLease struct {
+	Name      string    `gorm:"primaryKey"`
+	Holder    string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+func (OutboxLease) TableName() string {
+	return "outbox_leases"
+}
+
+type OutboxWorker struct {
+	WorkerID    string    `gorm:"primaryKey"`
+	HeartbeatAt time.Time `gorm:"not null"`
+}
+
+func (OutboxWorker) TableName() string {
+	return "outbox_workers"
+}
@@ -3,10 +3,13 @@ package entity
 import (
 	"time"
 
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/events"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+const UserAggregate = events.UserAggregate
+
 type User struct {
 	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
 	Name      string    `gorm:"not null"`
@@ -14,8 +17,85 @@ type User struct {
 	CreatedAt time.Time `gorm:"not null"`
 	UpdatedAt time.Time `gorm:"not null"`
 	DeletedAt gorm.DeletedAt
+
+	Events `gorm:"-" json:"-"`
 }
 
 func (User) TableName() string {
 	return "users"
 }
+
+func NewUser(name, email string) User {
+	now := time.Now().UTC()
+	user := User{
+		ID:        uuid.New(),
+		Name:      name,
+		Email:     email,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	user.Record(events.UserCreatedV1{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+	})
+	return user
+}
+
+// Update applies name and email and records a UserUpdated listing the
+// fields that changed with their previous values. An email change also
+// records UserEmailChanged.
+func (u *User) Update(name, email string) {
+	updated := events.UserUpdatedV1{
+		ID:       u.ID,
+		Previous: map[string]string{},
+		Current:  map[string]string{},
+	}
+	if u.Name != name {
+		updated.ChangedFields = append(updated.ChangedFields, "name")
+		updated.Previous["name"] = u.Name
+		updated.Current["name"] = name
+	}
+	if u.Email != email {
+		updated.ChangedFields = append(updated.ChangedFields, "email")
+		updated.Previous["email"] = u.Email
+		updated.Current["email"] = email
+	}
+	if len(updated.ChangedFields) == 0 {
+		return
+	}
+
+	previousEmail := u.Email
+	u.Name = name
+	u.Email = email
+	u.UpdatedAt = time.Now().UTC()
+	updated.UpdatedAt = u.UpdatedAt
+	u.Record(updated)
+
+	if previousEmail != email {
+		u.Record(events.UserEmailChangedV1{
+			ID:            u.ID,
+			PreviousEmail: previousEmail,
+			Email:         email,
+			ChangedAt:     u.UpdatedAt,
+		})
+	}
+}
+
+func (u *User) Rename(name string) {
+	u.Update(name, u.Email)
+}
+
+func (u *User) ChangeEmail(email string) {
+	u.Update(u.Name, email)
+}
+
+func (u *User) Delete() {
+	u.Record(events.UserDeletedV1{
+		ID:        u.ID,
+		Name:      u.Name,
+		Email:     u.Email,
+		DeletedAt: time.Now().UTC(),
+	})
+}
@@ -0,0 +1,143 @@
+// Package events holds the versioned contracts of every published event
+// and the JSON Schemas generated from them.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var ErrInvalidPayload = errors.New("events: payload does not match schema")
+
+// Versioned is implemented by payloads that know their contract version.
+type Versioned interface {
+	EventType() string
+	SchemaVersion() int
+}
+
+// Definition ties an event type and version to the Go type of its payload
+// and, when it can be published as protobuf, to its generated message.
+type Definition struct {
+	Type    string
+	Version int
+	Payload any
+	Proto   proto.Message
+}
+
+// Name identifies the definition, e.g. "user.created.v1".
+func (d Definition) Name() string {
+	return fmt.Sprintf("%s.v%d", d.Type, d.Version)
+}
+
+type key struct {
+	eventType string
+	version   int
+}
+
+var (
+	mu          sync.RWMutex
+	definitions = map[key]Definition{}
+	schemas     = map[key]Schema{}
+)
+
+// Register adds definitions, generating their schemas. It panics on a
+// duplicate, which is a programming error.
+func Register(defs ...Definition) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, d := range defs {
+		k := key{d.Type, d.Version}
+		if _, ok := definitions[k]; ok {
+			panic("events: duplicate definition " + d.Name())
+		}
+		definitions[k] = d
+		schemas[k] = Generate(d)
+	}
+}
+
+// Lookup returns the definition of eventType at version.
+func Lookup(eventType string, version int) (Definition, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	d, ok := definitions[key{eventType, version}]
+	return d, ok
+}
+
+// Latest returns the highest registered version of eventType.
+func Latest(eventType string) (Definition, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	var (
+		latest Definition
+		found  bool
+	)
+	for k, d := range definitions {
+		if k.eventType == eventType && (!found || d.Version > latest.Version) {
+			latest, found = d, true
+		}
+	}
+	return latest, found
+}
+
+// All returns every definition ordered by type and version.
+func All() []Definition {
+	mu.RLock()
+	defer mu.RUnlock()
+	defs := make([]Definition, 0, len(definitions))
+	for _, d := range definitions {
+		defs = append(defs, d)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		if defs[i].Type != defs[j].Type {
+			return defs[i].Type < defs[j].Type
+		}
+		return defs[i].Version < defs[j].Version
+	})
+	return defs
+}
+
+// SchemaFor returns the generated schema of eventType at version.
+func SchemaFor(eventType string, version int) (Schema, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	s, ok := schemas[key{eventType, version}]
+	return s, ok
+}
+
+// Validate checks data against the schema of eventType at version. Event
+// types without a registered contract are not checked.
+func Validate(eventType string, version int, data []byte) error {
+	schema, ok := SchemaFor(eventType, version)
+	if !ok {
+		if _, known := Latest(eventType); known {
+			return fmt.Errorf("%w: %s has no version %d", ErrInvalidPayload, eventType, version)
+		}
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("%w: %s.v%d: %v", ErrInvalidPayload, eventType, version, err)
+	}
+	if err := schema.validate(value, ""); err != nil {
+		return fmt.Errorf("%w: %s.v%d: %v", ErrInvalidPayload, eventType, version, err)
+	}
+	return nil
+}
+
+// ParseVersion reads a schema version header; empty means 1.
+func ParseVersion(v string) (int, error) {
+	if v == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("events: invalid schema version %q", v)
+	}
+	return n, nil
+}
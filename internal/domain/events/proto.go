@@ -0,0 +1,52 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const ContentTypeProtobuf = "application/protobuf"
+
+var ErrNoProto = errors.New("events: no protobuf type")
+
+// HasProto reports whether eventType at version has a protobuf encoding.
+func HasProto(eventType string, version int) bool {
+	d, ok := Lookup(eventType, version)
+	return ok && d.Proto != nil
+}
+
+// ToProto converts a JSON payload into its protobuf encoding. Field names
+// in the .proto files match the JSON names, so the conversion is lossless.
+func ToProto(eventType string, version int, data []byte) ([]byte, error) {
+	msg, err := newProto(eventType, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("events: %s.v%d to protobuf: %w", eventType, version, err)
+	}
+	return proto.Marshal(msg)
+}
+
+// FromProto converts a protobuf payload back into its JSON form.
+func FromProto(eventType string, version int, data []byte) ([]byte, error) {
+	msg, err := newProto(eventType, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("%w: %s.v%d: %v", ErrInvalidPayload, eventType, version, err)
+	}
+	return protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(msg)
+}
+
+func newProto(eventType string, version int) (proto.Message, error) {
+	d, ok := Lookup(eventType, version)
+	if !ok || d.Proto == nil {
+		return nil, fmt.Errorf("%w: %s.v%d", ErrNoProto, eventType, version)
+	}
+	return d.Proto.ProtoReflect().New().Interface(), nil
+}
@@ -0,0 +1,85 @@
+package events_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/events"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+)
+
+const schemaDir = "../../../schemas/events"
+
+// The committed schemas are the published contracts: a change to an event
+// type must come with a new version, not an edit to an existing one.
+func TestSchemasMatchCommittedContracts(t *testing.T) {
+	want := map[string]bool{}
+	for _, d := range events.All() {
+		name := d.Name() + ".json"
+		want[name] = true
+		schema, ok := events.SchemaFor(d.Type, d.Version)
+		if !ok {
+			t.Errorf("%s: no schema", d.Name())
+			continue
+		}
+		data, err := schema.JSON()
+		if err != nil {
+			t.Fatalf("%s: %v", d.Name(), err)
+		}
+		committed, err := os.ReadFile(filepath.Join(schemaDir, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(committed, data) {
+			t.Errorf("%s differs from the event type; add a new version or run `events schemas --write`", name)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(schemaDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if !want[filepath.Base(f)] {
+			t.Errorf("%s: no registered event", filepath.Base(f))
+		}
+	}
+}
+
+func TestEveryOldVersionHasAnUpcaster(t *testing.T) {
+	if missing := events.CheckUpcasters(); len(missing) > 0 {
+		t.Errorf("no upcaster to the next version: %v", missing)
+	}
+}
+
+// The HTTP API binds email with gin's validator; the event schema must
+// agree with it so an accepted request never fails to record its event.
+func TestEmailFormatMatchesRequestBinding(t *testing.T) {
+	type request struct {
+		Email string `binding:"email"`
+	}
+	for _, email := range []string{
+		"a@example.com",
+		"first.last+tag@sub.example.co",
+		"A <a@example.com>",
+		"a@example",
+		"@example.com",
+		"a@@example.com",
+		" a@example.com",
+	} {
+		bound := binding.Validator.ValidateStruct(request{Email: email}) == nil
+		payload, err := json.Marshal(events.UserEmailChangedV1{ID: uuid.New(), PreviousEmail: "old@example.com", Email: email, ChangedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		valid := events.Validate(events.TypeUserEmailChanged, 1, payload) == nil
+		if valid != bound {
+			t.Errorf("%q: schema valid %t, request binding valid %t", email, valid, bound)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrNoUpcaster = errors.New("events: no upcaster")
+
+// UpcastFunc rewrites a payload of one version into the next version.
+type UpcastFunc func(data []byte) ([]byte, error)
+
+var upcasters = map[key]UpcastFunc{}
+
+// RegisterUpcaster adds the step that turns eventType payloads of version
+// from into version from+1. It panics on a duplicate.
+func RegisterUpcaster(eventType string, from int, fn UpcastFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	k := key{eventType, from}
+	if _, ok := upcasters[k]; ok {
+		panic(fmt.Sprintf("events: duplicate upcaster %s.v%d", eventType, from))
+	}
+	upcasters[k] = fn
+}
+
+// Upcaster adapts a typed conversion between two payload versions.
+func Upcaster[From, To any](fn func(From) To) UpcastFunc {
+	return func(data []byte) ([]byte, error) {
+		var from From
+		if err := json.Unmarshal(data, &from); err != nil {
+			return nil, err
+		}
+		return json.Marshal(fn(from))
+	}
+}
+
+// Upcast applies the registered steps until data is at the latest version
+// of eventType, validating each step's output. Event types without a
+// contract, and payloads already at the latest version, are returned as is.
+func Upcast(eventType string, version int, data []byte) ([]byte, int, error) {
+	latest, ok := Latest(eventType)
+	if !ok {
+		return data, version, nil
+	}
+	for version < latest.Version {
+		mu.RLock()
+		fn, ok := upcasters[key{eventType, version}]
+		mu.RUnlock()
+		if !ok {
+			return nil, version, fmt.Errorf("%w: %s.v%d", ErrNoUpcaster, eventType, version)
+		}
+		next, err := fn(data)
+		if err != nil {
+			return nil, version, fmt.Errorf("events: upcast %s.v%d: %w", eventType, version, err)
+		}
+		version++
+		if err := Validate(eventType, version, next); err != nil {
+			return nil, version, err
+		}
+		data = next
+	}
+	return data, version, nil
+}
+
+// CheckUpcasters lists the versions that cannot reach the latest one.
+func CheckUpcasters() []string {
+	var missing []string
+	for _, d := range All() {
+		latest, _ := Latest(d.Type)
+		if d.Version == latest.Version {
+			continue
+		}
+		mu.RLock()
+		_, ok := upcasters[key{d.Type, d.Version}]
+		mu.RUnlock()
+		if !ok {
+			missing = append(missing, d.Name())
+		}
+	}
+	return missing
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/events/eventspb"
+	"github.com/google/uuid"
+)
+
+const UserAggregate = "user"
+
+const (
+	TypeUserCreated      = "user.created"
+	TypeUserUpdated      = "user.updated"
+	TypeUserEmailChanged = "user.email_changed"
+	TypeUserDeleted      = "user.deleted"
+)
+
+func init() {
+	Register(
+		Definition{Type: TypeUserCreated, Version: 1, Payload: UserCreatedV1{}},
+		Definition{Type: TypeUserCreated, Version: 2, Payload: UserCreatedV2{}, Proto: &eventspb.UserCreatedV2{}},
+		Definition{Type: TypeUserUpdated, Version: 1, Payload: UserUpdatedV1{}, Proto: &eventspb.UserUpdatedV1{}},
+		Definition{Type: TypeUserEmailChanged, Version: 1, Payload: UserEmailChangedV1{}, Proto: &eventspb.UserEmailChangedV1{}},
+		Definition{Type: TypeUserDeleted, Version: 1, Payload: UserDeletedV1{}, Proto: &eventspb.UserDeletedV1{}},
+	)
+	RegisterUpcaster(TypeUserCreated, 1, Upcaster(func(e UserCreatedV1) UserCreatedV2 {
+		return UserCreatedV2{
+			ID:        e.ID,
+			Profile:   UserProfile{Name: e.Name, Email: e.Email},
+			CreatedAt: e.CreatedAt,
+		}
+	}))
+}
+
+// UserCreatedV1 is what NewUser produces. Consumers upcast it to
+// UserCreatedV2.
+type UserCreatedV1 struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name" schema:"minLength=1"`
+	Email     string    `json:"email" schema:"format=email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (e UserCreatedV1) AggregateType() string  { return UserAggregate }
+func (e UserCreatedV1) AggregateID() uuid.UUID { return e.ID }
+func (e UserCreatedV1) EventType() string      { return TypeUserCreated }
+func (e UserCreatedV1) SchemaVersion() int     { return 1 }
+
+type UserProfile struct {
+	Name  string `json:"name" schema:"minLength=1"`
+	Email string `json:"email" schema:"format=email"`
+}
+
+type UserCreatedV2 struct {
+	ID        uuid.UUID   `json:"id"`
+	Profile   UserProfile `json:"profile"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+func (e UserCreatedV2) AggregateType() string  { return UserAggregate }
+func (e UserCreatedV2) AggregateID() uuid.UUID { return e.ID }
+func (e UserCreatedV2) EventType() string      { return TypeUserCreated }
+func (e UserCreatedV2) SchemaVersion() int     { return 2 }
+
+type UserUpdatedV1 struct {
+	ID            uuid.UUID         `json:"id"`
+	ChangedFields []string          `json:"changed_fields" schema:"minItems=1"`
+	Previous      map[string]string `json:"previous"`
+	Current       map[string]string `json:"current"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+func (e UserUpdatedV1) AggregateType() string  { return UserAggregate }
+func (e UserUpdatedV1) AggregateID() uuid.UUID { return e.ID }
+func (e UserUpdatedV1) EventType() string      { return TypeUserUpdated }
+func (e UserUpdatedV1) SchemaVersion() int     { return 1 }
+
+type UserEmailChangedV1 struct {
+	ID            uuid.UUID `json:"id"`
+	PreviousEmail string    `json:"previous_email" schema:"format=email"`
+	Email         string    `json:"email" schema:"format=email"`
+	ChangedAt     time.Time `json:"changed_at"`
+}
+
+func (e UserEmailChangedV1) AggregateType() string  { return UserAggregate }
+func (e UserEmailChangedV1) AggregateID() uuid.UUID { return e.ID }
+func (e UserEmailChangedV1) EventType() string      { return TypeUserEmailChanged }
+func (e UserEmailChangedV1) SchemaVersion() int     { return 1 }
+
+type UserDeletedV1 struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func (e UserDeletedV1) AggregateType() string  { return UserAggregate }
+func (e UserDeletedV1) AggregateID() uuid.UUID { return e.ID }
+func (e UserDeletedV1) EventType() string      { return TypeUserDeleted }
+func (e UserDeletedV1) SchemaVersion() int     { return 1 }
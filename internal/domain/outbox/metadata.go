@@ -0,0 +1,47 @@
+package outbox
+
+import "context"
+
+const (
+	HeaderRequestID   = "X-Request-ID"
+	HeaderTraceParent = "traceparent"
+	// HeaderClaimedActor is the caller's X-Actor request header. Nothing
+	// authenticates it, so it records who the caller claims to be.
+	HeaderClaimedActor  = "X-Claimed-Actor"
+	HeaderLegacyActor   = "X-Actor"
+	HeaderSchemaVersion = "X-Event-Schema-Version"
+	HeaderEventID       = "X-Event-ID"
+	HeaderEventType     = "X-Event-Type"
+	HeaderAggregateType = "X-Aggregate-Type"
+	HeaderAggregateID   = "X-Aggregate-ID"
+
+	DefaultSchemaVersion = "1"
+)
+
+type headersKey struct{}
+
+// WithHeaders returns a context whose enqueued events inherit headers, on
+// top of any headers already carried by ctx.
+func WithHeaders(ctx context.Context, headers Headers) context.Context {
+	merged := HeadersFrom(ctx)
+	for k, v := range headers {
+		if v != "" {
+			merged[k] = v
+		}
+	}
+	return context.WithValue(ctx, headersKey{}, merged)
+}
+
+// HeadersFrom returns a copy of the headers carried by ctx.
+func HeadersFrom(ctx context.Context) Headers {
+	out := Headers{}
+	if ctx == nil {
+		return out
+	}
+	if headers, ok := ctx.Value(headersKey{}).(Headers); ok {
+		for k, v := range headers {
+			out[k] = v
+		}
+	}
+	return out
+}
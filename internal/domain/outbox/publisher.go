@@ -0,0 +1,38 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Headers map[string]string
+
+// Publisher records events in the transactional outbox. Implementations
+// join the transaction started by repository.Store.WithTx when ctx carries
+// one, so the event commits or rolls back together with the state change.
+type Publisher interface {
+	Enqueue(ctx context.Context, aggregateType string, aggregateID uuid.UUID, eventType string, payload any, headers Headers, opts ...Option) (uuid.UUID, error)
+	Cancel(ctx context.Context, id uuid.UUID) error
+}
+
+type Options struct {
+	AvailableAt time.Time
+}
+
+type Option func(*Options)
+
+// At holds the event back until t.
+func At(t time.Time) Option {
+	return func(o *Options) {
+		o.AvailableAt = t.UTC()
+	}
+}
+
+// After holds the event back for delay from now.
+func After(delay time.Duration) Option {
+	return func(o *Options) {
+		o.AvailableAt = time.Now().UTC().Add(delay)
+	}
+}
@@ -4,3 +4,4 @@ import "errors"
 
 var ErrIdempotencyKeyConflict = errors.New("idempotency key conflicts with request")
 var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrOutboxEventNotCancellable = errors.New("outbox event is already published, in flight or cancelled")
@@ -8,10 +8,10 @@ import (
 )
 
 type UserRepository interface {
-	Create(ctx context.Context, name, email string) (entity.User, error)
-	CreateIdempotent(ctx context.Context, name, email, key, requestHash string) (entity.User, bool, error)
+	Create(ctx context.Context, user entity.User) (entity.User, error)
+	CreateIdempotent(ctx context.Context, user entity.User, key, requestHash string) (entity.User, bool, error)
 	GetByID(ctx context.Context, id uuid.UUID) (entity.User, error)
-	Update(ctx context.Context, id uuid.UUID, name, email string) (entity.User, error)
+	Update(ctx context.Context, id uuid.UUID, mutate func(user *entity.User) error) (entity.User, error)
 	DeleteByID(ctx context.Context, id uuid.UUID) error
 	ListCursor(ctx context.Context, limit int, cursor string) ([]entity.User, error)
 }
@@ -0,0 +1,280 @@
+// Package signing signs published messages with Ed25519 or HMAC-SHA256 and
+// verifies them on delivery. A signature covers the subject, the body and
+// the headers listed in X-Signature-Headers, and names the key it was made
+// with so keys can be rotated.
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+)
+
+const (
+	HeaderSignature = "X-Signature"
+	HeaderKeyID     = "X-Signature-Key-Id"
+	HeaderAlgorithm = "X-Signature-Algorithm"
+	HeaderHeaders   = "X-Signature-Headers"
+
+	AlgorithmEd25519    = "ed25519"
+	AlgorithmHMACSHA256 = "hmac-sha256"
+
+	// MinSecretLength is the shortest accepted HMAC secret, in bytes.
+	MinSecretLength = 32
+
+	signatureContext = "simple-backend-signature-v1"
+)
+
+// ErrSignature is wrapped by every verification failure.
+var ErrSignature = errors.New("signing: signature rejected")
+
+// Key is a signing or verification key. Ed25519 keys are read from PEM
+// (PKCS #8 private or PKIX public); anything else is an HMAC secret.
+type Key struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	private   ed25519.PrivateKey
+	public    ed25519.PublicKey
+}
+
+// ParseKey reads the key stored in data under id.
+func ParseKey(id string, data []byte) (Key, error) {
+	if id == "" {
+		return Key{}, errors.New("signing: key id is required")
+	}
+	if strings.Contains(id, ",") {
+		return Key{}, fmt.Errorf("signing: key id %q must not contain a comma", id)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		secret := bytes.TrimSpace(data)
+		if len(secret) < MinSecretLength {
+			return Key{}, fmt.Errorf("signing: key %s: hmac secret must be at least %d bytes", id, MinSecretLength)
+		}
+		return Key{ID: id, Algorithm: AlgorithmHMACSHA256, secret: secret}, nil
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("signing: key %s: %w", id, err)
+		}
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return Key{}, fmt.Errorf("signing: key %s: not an ed25519 private key", id)
+		}
+		return Key{ID: id, Algorithm: AlgorithmEd25519, private: private, public: private.Public().(ed25519.PublicKey)}, nil
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("signing: key %s: %w", id, err)
+		}
+		public, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return Key{}, fmt.Errorf("signing: key %s: not an ed25519 public key", id)
+		}
+		return Key{ID: id, Algorithm: AlgorithmEd25519, public: public}, nil
+	default:
+		return Key{}, fmt.Errorf("signing: key %s: unsupported PEM block %q", id, block.Type)
+	}
+}
+
+// GenerateKey returns a new key for algorithm. For Ed25519, private is a
+// PKCS #8 PEM block and public a PKIX one; for HMAC both are the same
+// base64 secret.
+func GenerateKey(algorithm string) (private, public []byte, err error) {
+	switch algorithm {
+	case AlgorithmEd25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return nil, nil, err
+		}
+		pubDER, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+			pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), nil
+	case AlgorithmHMACSHA256:
+		secret := make([]byte, MinSecretLength)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, nil, err
+		}
+		encoded := []byte(base64.StdEncoding.EncodeToString(secret) + "\n")
+		return encoded, encoded, nil
+	default:
+		return nil, nil, fmt.Errorf("signing: algorithm %q: supported values are %s or %s", algorithm, AlgorithmEd25519, AlgorithmHMACSHA256)
+	}
+}
+
+func (k Key) canSign() bool   { return k.private != nil || k.secret != nil }
+func (k Key) canVerify() bool { return k.public != nil || k.secret != nil }
+
+// Signer signs messages with one key.
+type Signer struct {
+	key Key
+}
+
+func NewSigner(key Key) (*Signer, error) {
+	if !key.canSign() {
+		return nil, fmt.Errorf("signing: key %s cannot sign (public key only)", key.ID)
+	}
+	return &Signer{key: key}, nil
+}
+
+// KeyID is the id of the signing key.
+func (s *Signer) KeyID() string { return s.key.ID }
+
+// Sign adds the signature headers to headers. Every non-empty header is
+// covered except Nats-Msg-Id, which changes when a message is replayed.
+func (s *Signer) Sign(subject string, data []byte, headers map[string]string) {
+	names := make([]string, 0, len(headers))
+	for name, value := range headers {
+		if value == "" || name == broker.HeaderMsgID || isSignatureHeader(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msg := signedBytes(s.key.Algorithm, s.key.ID, subject, names, headers, data)
+
+	var sig []byte
+	if s.key.Algorithm == AlgorithmEd25519 {
+		sig = ed25519.Sign(s.key.private, msg)
+	} else {
+		sig = mac(s.key.secret, msg)
+	}
+	headers[HeaderAlgorithm] = s.key.Algorithm
+	headers[HeaderKeyID] = s.key.ID
+	headers[HeaderHeaders] = strings.Join(names, ",")
+	headers[HeaderSignature] = base64.StdEncoding.EncodeToString(sig)
+}
+
+// Verifier checks signatures against a set of trusted keys.
+type Verifier struct {
+	keys     map[string]Key
+	required bool
+}
+
+// NewVerifier trusts keys. When required is false, unsigned messages are
+// accepted, which allows signing to be rolled out producer first.
+func NewVerifier(required bool, keys ...Key) (*Verifier, error) {
+	v := &Verifier{keys: map[string]Key{}, required: required}
+	for _, k := range keys {
+		if !k.canVerify() {
+			return nil, fmt.Errorf("signing: key %s cannot verify", k.ID)
+		}
+		if prev, ok := v.keys[k.ID]; ok && !sameKey(prev, k) {
+			return nil, fmt.Errorf("signing: key id %s is used by two different keys", k.ID)
+		}
+		v.keys[k.ID] = k
+	}
+	if required && len(v.keys) == 0 {
+		return nil, errors.New("signing: signatures are required but no keys are trusted")
+	}
+	return v, nil
+}
+
+// Verify checks the signature of a delivered message and returns the names
+// of the headers it covers. An unsigned message returns nil names, and an
+// error only when signatures are required.
+func (v *Verifier) Verify(subject string, data []byte, headers map[string]string) ([]string, error) {
+	encoded := headers[HeaderSignature]
+	if encoded == "" {
+		if v.required {
+			return nil, fmt.Errorf("%w: message is not signed", ErrSignature)
+		}
+		return nil, nil
+	}
+	keyID := headers[HeaderKeyID]
+	key, ok := v.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrSignature, keyID)
+	}
+	if alg := headers[HeaderAlgorithm]; alg != key.Algorithm {
+		return nil, fmt.Errorf("%w: key %s is %s, message claims %q", ErrSignature, keyID, key.Algorithm, alg)
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrSignature)
+	}
+	var names []string
+	if list := headers[HeaderHeaders]; list != "" {
+		names = strings.Split(list, ",")
+	}
+	for _, name := range names {
+		if _, ok := headers[name]; !ok {
+			return nil, fmt.Errorf("%w: signed header %s is missing", ErrSignature, name)
+		}
+	}
+	msg := signedBytes(key.Algorithm, keyID, subject, names, headers, data)
+
+	var valid bool
+	if key.Algorithm == AlgorithmEd25519 {
+		valid = ed25519.Verify(key.public, msg, sig)
+	} else {
+		valid = hmac.Equal(mac(key.secret, msg), sig)
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: signature does not match (key %s)", ErrSignature, keyID)
+	}
+	return names, nil
+}
+
+// signedBytes is the canonical form that is signed. Every field is length
+// prefixed so no two messages share an encoding.
+func signedBytes(algorithm, keyID, subject string, names []string, headers map[string]string, data []byte) []byte {
+	var b bytes.Buffer
+	field := func(v string) {
+		b.Write(binary.BigEndian.AppendUint32(nil, uint32(len(v))))
+		b.WriteString(v)
+	}
+	field(signatureContext)
+	field(algorithm)
+	field(keyID)
+	field(subject)
+	b.Write(binary.BigEndian.AppendUint32(nil, uint32(len(names))))
+	for _, name := range names {
+		field(name)
+		field(headers[name])
+	}
+	field(string(data))
+	return b.Bytes()
+}
+
+func mac(secret, msg []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+func sameKey(a, b Key) bool {
+	if a.Algorithm != b.Algorithm {
+		return false
+	}
+	if a.Algorithm == AlgorithmEd25519 {
+		return a.public.Equal(b.public)
+	}
+	return hmac.Equal(a.secret, b.secret)
+}
+
+func isSignatureHeader(name string) bool {
+	return name == HeaderSignature || name == HeaderKeyID || name == HeaderAlgorithm || name == HeaderHeaders
+}
@@ -0,0 +1,227 @@
+package signing_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/signing"
+)
+
+const subject = "user.created"
+
+var body = []byte(`{"id":"7d3c9f2e-1a2b-4c3d-8e9f-0a1b2c3d4e5f"}`)
+
+// keys returns the signing and verification halves of a new key. For
+// Ed25519 the verification half holds only the public key.
+func keys(t *testing.T, algorithm, id string) (signing.Key, signing.Key) {
+	t.Helper()
+	private, public, err := signing.GenerateKey(algorithm)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	signKey, err := signing.ParseKey(id, private)
+	if err != nil {
+		t.Fatalf("parse private: %v", err)
+	}
+	verifyKey, err := signing.ParseKey(id, public)
+	if err != nil {
+		t.Fatalf("parse public: %v", err)
+	}
+	if signKey.Algorithm != algorithm || verifyKey.Algorithm != algorithm {
+		t.Fatalf("parsed as %s/%s, want %s", signKey.Algorithm, verifyKey.Algorithm, algorithm)
+	}
+	return signKey, verifyKey
+}
+
+func newSigner(t *testing.T, key signing.Key) *signing.Signer {
+	t.Helper()
+	signer, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	return signer
+}
+
+func keyPair(t *testing.T, algorithm, id string, required bool) (*signing.Signer, *signing.Verifier) {
+	t.Helper()
+	signKey, verifyKey := keys(t, algorithm, id)
+	verifier, err := signing.NewVerifier(required, verifyKey)
+	if err != nil {
+		t.Fatalf("verifier: %v", err)
+	}
+	return newSigner(t, signKey), verifier
+}
+
+func signedHeaders(signer *signing.Signer) map[string]string {
+	headers := map[string]string{
+		"X-Event-Type":     subject,
+		"X-Request-Id":     "req-1",
+		broker.HeaderMsgID: "evt-1",
+		"X-Empty":          "",
+	}
+	signer.Sign(subject, body, headers)
+	return headers
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{signing.AlgorithmEd25519, signing.AlgorithmHMACSHA256} {
+		t.Run(algorithm, func(t *testing.T) {
+			signer, verifier := keyPair(t, algorithm, "k1", true)
+			headers := signedHeaders(signer)
+			if headers[signing.HeaderKeyID] != "k1" || headers[signing.HeaderAlgorithm] != algorithm {
+				t.Fatalf("signature headers %v", headers)
+			}
+			names, err := verifier.Verify(subject, body, headers)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			// Nats-Msg-Id changes on replay and empty headers are not sent.
+			if want := []string{"X-Event-Type", "X-Request-Id"}; !reflect.DeepEqual(names, want) {
+				t.Fatalf("covered %v, want %v", names, want)
+			}
+
+			// A replayed message gets a new Nats-Msg-Id and still verifies.
+			headers[broker.HeaderMsgID] = "evt-1-replay"
+			if _, err := verifier.Verify(subject, body, headers); err != nil {
+				t.Fatalf("verify with a new msg id: %v", err)
+			}
+		})
+	}
+}
+
+func TestTamperingIsRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		body    []byte
+		tamper  func(map[string]string)
+	}{
+		{name: "body", subject: subject, body: []byte(`{"id":"someone-else"}`)},
+		{name: "subject", subject: "user.deleted", body: body},
+		{name: "covered header", subject: subject, body: body, tamper: func(h map[string]string) { h["X-Request-Id"] = "req-2" }},
+		{name: "covered header removed", subject: subject, body: body, tamper: func(h map[string]string) { delete(h, "X-Request-Id") }},
+		{name: "covered list shortened", subject: subject, body: body, tamper: func(h map[string]string) { h[signing.HeaderHeaders] = "X-Event-Type" }},
+		{name: "algorithm changed", subject: subject, body: body, tamper: func(h map[string]string) { h[signing.HeaderAlgorithm] = "none" }},
+		{name: "malformed signature", subject: subject, body: body, tamper: func(h map[string]string) { h[signing.HeaderSignature] = "not base64!" }},
+	}
+	for _, algorithm := range []string{signing.AlgorithmEd25519, signing.AlgorithmHMACSHA256} {
+		signer, verifier := keyPair(t, algorithm, "k1", true)
+		for _, tt := range tests {
+			t.Run(algorithm+"/"+tt.name, func(t *testing.T) {
+				headers := signedHeaders(signer)
+				if tt.tamper != nil {
+					tt.tamper(headers)
+				}
+				if _, err := verifier.Verify(tt.subject, tt.body, headers); !errors.Is(err, signing.ErrSignature) {
+					t.Fatalf("verify = %v, want ErrSignature", err)
+				}
+			})
+		}
+	}
+}
+
+// Headers outside the signature may be added on the way, but the caller
+// only ever sees the covered ones.
+func TestUncoveredHeaderIsNotReported(t *testing.T) {
+	signer, verifier := keyPair(t, signing.AlgorithmEd25519, "k1", true)
+	headers := signedHeaders(signer)
+	headers["X-Claimed-Actor"] = "admin"
+	names, err := verifier.Verify(subject, body, headers)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	for _, name := range names {
+		if name == "X-Claimed-Actor" {
+			t.Fatal("a header added after signing is reported as covered")
+		}
+	}
+}
+
+func TestUnknownKeyIsRejected(t *testing.T) {
+	signer, _ := keyPair(t, signing.AlgorithmEd25519, "retired", true)
+	_, verifier := keyPair(t, signing.AlgorithmEd25519, "current", true)
+	if _, err := verifier.Verify(subject, body, signedHeaders(signer)); !errors.Is(err, signing.ErrSignature) {
+		t.Fatalf("verify = %v, want ErrSignature", err)
+	}
+
+	// A key that is trusted under the same id but is a different key.
+	other, _ := keyPair(t, signing.AlgorithmEd25519, "current", true)
+	if _, err := verifier.Verify(subject, body, signedHeaders(other)); !errors.Is(err, signing.ErrSignature) {
+		t.Fatalf("verify with another key under a trusted id = %v, want ErrSignature", err)
+	}
+}
+
+func TestRotationTrustsOldAndNewKeys(t *testing.T) {
+	oldKey, oldVerify := keys(t, signing.AlgorithmHMACSHA256, "2026-01")
+	newKey, newVerify := keys(t, signing.AlgorithmEd25519, "2026-07")
+	verifier, err := signing.NewVerifier(true, oldVerify, newVerify)
+	if err != nil {
+		t.Fatalf("verifier: %v", err)
+	}
+	for _, key := range []signing.Key{oldKey, newKey} {
+		if _, err := verifier.Verify(subject, body, signedHeaders(newSigner(t, key))); err != nil {
+			t.Fatalf("key %s: %v", key.ID, err)
+		}
+	}
+
+	_, reused := keys(t, signing.AlgorithmEd25519, "2026-01")
+	if _, err := signing.NewVerifier(true, oldVerify, newVerify, reused); err == nil {
+		t.Fatal("two different keys under one id accepted")
+	}
+}
+
+func TestUnsignedMessages(t *testing.T) {
+	_, required := keyPair(t, signing.AlgorithmEd25519, "k1", true)
+	if _, err := required.Verify(subject, body, map[string]string{"X-Event-Type": subject}); !errors.Is(err, signing.ErrSignature) {
+		t.Fatalf("required: verify unsigned = %v, want ErrSignature", err)
+	}
+
+	signer, optional := keyPair(t, signing.AlgorithmEd25519, "k1", false)
+	names, err := optional.Verify(subject, body, map[string]string{"X-Event-Type": subject})
+	if err != nil || names != nil {
+		t.Fatalf("optional: verify unsigned = %v, %v; want nil, nil", names, err)
+	}
+	// Optional only covers messages without a signature; a bad one still fails.
+	headers := signedHeaders(signer)
+	headers["X-Request-Id"] = "req-2"
+	if _, err := optional.Verify(subject, body, headers); !errors.Is(err, signing.ErrSignature) {
+		t.Fatalf("optional: verify tampered = %v, want ErrSignature", err)
+	}
+
+	if _, err := signing.NewVerifier(true); err == nil {
+		t.Fatal("required signatures without trusted keys accepted")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	_, public, err := signing.GenerateKey(signing.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicOnly, err := signing.ParseKey("k1", public)
+	if err != nil {
+		t.Fatalf("parse public: %v", err)
+	}
+	if _, err := signing.NewSigner(publicOnly); err == nil {
+		t.Fatal("signer built from a public key")
+	}
+	for _, tt := range []struct {
+		name string
+		id   string
+		data []byte
+	}{
+		{name: "no id", id: "", data: public},
+		{name: "comma in id", id: "a,b", data: public},
+		{name: "short hmac secret", id: "k1", data: []byte("too-short")},
+		{name: "unsupported pem block", id: "k1", data: []byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n")},
+	} {
+		if _, err := signing.ParseKey(tt.id, tt.data); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+	if _, _, err := signing.GenerateKey("rsa"); err == nil {
+		t.Error("unknown algorithm accepted")
+	}
+}
@@ -0,0 +1,273 @@
+package coordination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+	"github.com/google/uuid"
+)
+
+const (
+	ModeNone    = "none"
+	ModeLeader  = "leader"
+	ModeSharded = "sharded"
+
+	leaderLease = "outbox-leader"
+)
+
+// Assignment describes what a worker may claim after a Sync. A zero
+// ShardCount means every aggregate; Ordered asks for head-of-line claims.
+type Assignment struct {
+	Active     bool
+	Ordered    bool
+	ShardCount int
+	Shards     []int
+}
+
+type Coordinator interface {
+	Sync(ctx context.Context) (Assignment, error)
+	// Renew extends the leases behind the last assignment without
+	// rebalancing. It returns false once any of them is lost.
+	Renew(ctx context.Context) (bool, error)
+	// RenewInterval is how often Renew must run while a batch is being
+	// published; zero means there is nothing to renew.
+	RenewInterval() time.Duration
+	Release(ctx context.Context)
+	WorkerID() string
+}
+
+// LeaseStore holds the named leases and the worker heartbeats the
+// coordinators agree through. persistence.LeaseRepository implements it.
+type LeaseStore interface {
+	// Acquire takes or renews the named lease for holder. It succeeds when
+	// the lease is free, expired, or already held by the same holder.
+	Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, name, holder string) error
+	Heartbeat(ctx context.Context, workerID string) error
+	// LiveWorkers returns the workers that sent a heartbeat within ttl,
+	// ordered by worker ID.
+	LiveWorkers(ctx context.Context, ttl time.Duration) ([]entity.OutboxWorker, error)
+	Leave(ctx context.Context, workerID string) error
+}
+
+func New(cfg config.Outbox, leases LeaseStore) (Coordinator, error) {
+	workerID := cfg.WorkerID
+	if workerID == "" {
+		workerID = defaultWorkerID()
+	}
+	ttl := cfg.LeaseTTL
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+
+	switch cfg.Coordination {
+	case "", ModeNone:
+		return &compete{workerID: workerID}, nil
+	case ModeLeader:
+		return &Leader{leases: leases, workerID: workerID, ttl: ttl}, nil
+	case ModeSharded:
+		if cfg.ShardCount <= 0 {
+			return nil, errors.New("coordination: shard_count must be positive")
+		}
+		return &Sharded{
+			leases:     leases,
+			workerID:   workerID,
+			ttl:        ttl,
+			shardCount: cfg.ShardCount,
+			owned:      make(map[int]bool),
+		}, nil
+	default:
+		return nil, errors.New("coordination: supported values are none, leader or sharded")
+	}
+}
+
+type compete struct {
+	workerID string
+}
+
+func (c *compete) Sync(ctx context.Context) (Assignment, error) {
+	return Assignment{Active: true}, nil
+}
+
+func (c *compete) Renew(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (c *compete) RenewInterval() time.Duration {
+	return 0
+}
+
+func (c *compete) Release(ctx context.Context) {}
+
+func (c *compete) WorkerID() string {
+	return c.workerID
+}
+
+// Leader lets exactly one worker publish at a time. Other workers stay hot
+// and take over once the lease expires or is released.
+type Leader struct {
+	leases   LeaseStore
+	workerID string
+	ttl      time.Duration
+	leading  bool
+}
+
+func (l *Leader) Sync(ctx context.Context) (Assignment, error) {
+	ok, err := l.leases.Acquire(ctx, leaderLease, l.workerID, l.ttl)
+	if err != nil {
+		l.leading = false
+		return Assignment{}, err
+	}
+	l.leading = ok
+	return Assignment{Active: ok, Ordered: true}, nil
+}
+
+func (l *Leader) Renew(ctx context.Context) (bool, error) {
+	if !l.leading {
+		return false, nil
+	}
+	ok, err := l.leases.Acquire(ctx, leaderLease, l.workerID, l.ttl)
+	if err != nil {
+		return false, err
+	}
+	l.leading = ok
+	return ok, nil
+}
+
+func (l *Leader) RenewInterval() time.Duration {
+	return l.ttl / 3
+}
+
+func (l *Leader) Release(ctx context.Context) {
+	if !l.leading {
+		return
+	}
+	_ = l.leases.Release(ctx, leaderLease, l.workerID)
+	l.leading = false
+}
+
+func (l *Leader) WorkerID() string {
+	return l.workerID
+}
+
+// Sharded splits aggregates into shardCount shards and spreads them across
+// live workers by rank. A shard is only published by the worker holding its
+// lease, and leases are handed over between batches, never mid-batch.
+type Sharded struct {
+	leases     LeaseStore
+	workerID   string
+	ttl        time.Duration
+	shardCount int
+	owned      map[int]bool
+}
+
+func (s *Sharded) Sync(ctx context.Context) (Assignment, error) {
+	if err := s.leases.Heartbeat(ctx, s.workerID); err != nil {
+		return Assignment{}, err
+	}
+	workers, err := s.leases.LiveWorkers(ctx, s.ttl)
+	if err != nil {
+		return Assignment{}, err
+	}
+	rank := -1
+	for i, w := range workers {
+		if w.WorkerID == s.workerID {
+			rank = i
+			break
+		}
+	}
+
+	desired := make(map[int]bool, s.shardCount)
+	if rank >= 0 {
+		for shard := 0; shard < s.shardCount; shard++ {
+			if shard%len(workers) == rank {
+				desired[shard] = true
+			}
+		}
+	}
+
+	for shard := range s.owned {
+		if desired[shard] {
+			continue
+		}
+		if err := s.leases.Release(ctx, shardLease(shard), s.workerID); err != nil {
+			return Assignment{}, err
+		}
+		delete(s.owned, shard)
+	}
+	for shard := range desired {
+		ok, err := s.leases.Acquire(ctx, shardLease(shard), s.workerID, s.ttl)
+		if err != nil {
+			return Assignment{}, err
+		}
+		if ok {
+			s.owned[shard] = true
+		} else {
+			delete(s.owned, shard)
+		}
+	}
+
+	shards := make([]int, 0, len(s.owned))
+	for shard := range s.owned {
+		shards = append(shards, shard)
+	}
+	sort.Ints(shards)
+	return Assignment{
+		Active:     len(shards) > 0,
+		Ordered:    true,
+		ShardCount: s.shardCount,
+		Shards:     shards,
+	}, nil
+}
+
+func (s *Sharded) Renew(ctx context.Context) (bool, error) {
+	if err := s.leases.Heartbeat(ctx, s.workerID); err != nil {
+		return false, err
+	}
+	held := true
+	for shard := range s.owned {
+		ok, err := s.leases.Acquire(ctx, shardLease(shard), s.workerID, s.ttl)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			delete(s.owned, shard)
+			held = false
+		}
+	}
+	return held, nil
+}
+
+func (s *Sharded) RenewInterval() time.Duration {
+	return s.ttl / 3
+}
+
+func (s *Sharded) Release(ctx context.Context) {
+	for shard := range s.owned {
+		_ = s.leases.Release(ctx, shardLease(shard), s.workerID)
+		delete(s.owned, shard)
+	}
+	_ = s.leases.Leave(ctx, s.workerID)
+}
+
+func (s *Sharded) WorkerID() string {
+	return s.workerID
+}
+
+func shardLease(shard int) string {
+	return fmt.Sprintf("outbox-shard-%d", shard)
+}
+
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return uuid.NewString()
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
@@ -0,0 +1,233 @@
+package coordination
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+)
+
+const testTTL = 15 * time.Second
+
+// fakeLeases follows the outbox_leases and outbox_workers semantics on a
+// clock the test moves by hand.
+type fakeLeases struct {
+	now        time.Time
+	leases     map[string]fakeLease
+	heartbeats map[string]time.Time
+}
+
+type fakeLease struct {
+	holder  string
+	expires time.Time
+}
+
+func newFakeLeases() *fakeLeases {
+	return &fakeLeases{
+		now:        time.Unix(0, 0),
+		leases:     map[string]fakeLease{},
+		heartbeats: map[string]time.Time{},
+	}
+}
+
+func (f *fakeLeases) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	if l, ok := f.leases[name]; ok && l.holder != holder && !l.expires.Before(f.now) {
+		return false, nil
+	}
+	f.leases[name] = fakeLease{holder: holder, expires: f.now.Add(ttl)}
+	return true, nil
+}
+
+func (f *fakeLeases) Release(ctx context.Context, name, holder string) error {
+	if l, ok := f.leases[name]; ok && l.holder == holder {
+		delete(f.leases, name)
+	}
+	return nil
+}
+
+func (f *fakeLeases) Heartbeat(ctx context.Context, workerID string) error {
+	f.heartbeats[workerID] = f.now
+	return nil
+}
+
+func (f *fakeLeases) LiveWorkers(ctx context.Context, ttl time.Duration) ([]entity.OutboxWorker, error) {
+	var workers []entity.OutboxWorker
+	for id, at := range f.heartbeats {
+		if at.After(f.now.Add(-ttl)) {
+			workers = append(workers, entity.OutboxWorker{WorkerID: id, HeartbeatAt: at})
+		}
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].WorkerID < workers[j].WorkerID })
+	return workers, nil
+}
+
+func (f *fakeLeases) Leave(ctx context.Context, workerID string) error {
+	delete(f.heartbeats, workerID)
+	return nil
+}
+
+// step acts as one worker: "sync" checks the assignment it gets, "release"
+// shuts it down cleanly, and "advance" moves the clock (worker unused).
+type step struct {
+	op      string
+	worker  string
+	advance time.Duration
+	active  bool
+	shards  []int
+}
+
+func runSteps(t *testing.T, mode string, steps []step) {
+	t.Helper()
+	leases := newFakeLeases()
+	workers := map[string]Coordinator{}
+	ctx := context.Background()
+	for i, s := range steps {
+		if s.op == "advance" {
+			leases.now = leases.now.Add(s.advance)
+			continue
+		}
+		coord, ok := workers[s.worker]
+		if !ok {
+			var err error
+			coord, err = New(config.Outbox{Coordination: mode, WorkerID: s.worker, LeaseTTL: testTTL, ShardCount: 4}, leases)
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+			workers[s.worker] = coord
+		}
+		switch s.op {
+		case "sync":
+			got, err := coord.Sync(ctx)
+			if err != nil {
+				t.Fatalf("step %d: sync %s: %v", i, s.worker, err)
+			}
+			if got.Active != s.active || !reflect.DeepEqual(got.Shards, s.shards) {
+				t.Fatalf("step %d: %s got active=%t shards=%v, want active=%t shards=%v",
+					i, s.worker, got.Active, got.Shards, s.active, s.shards)
+			}
+		case "release":
+			coord.Release(ctx)
+			delete(workers, s.worker)
+		}
+	}
+}
+
+func TestLeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "one leader, others stay hot",
+			steps: []step{
+				{op: "sync", worker: "a", active: true},
+				{op: "sync", worker: "b"},
+				{op: "sync", worker: "a", active: true},
+			},
+		},
+		{
+			name: "leader leaves",
+			steps: []step{
+				{op: "sync", worker: "a", active: true},
+				{op: "release", worker: "a"},
+				{op: "sync", worker: "b", active: true},
+				{op: "sync", worker: "a"},
+			},
+		},
+		{
+			name: "leader lease expires",
+			steps: []step{
+				{op: "sync", worker: "a", active: true},
+				{op: "advance", advance: testTTL - time.Second},
+				{op: "sync", worker: "b"},
+				{op: "advance", advance: 2 * time.Second},
+				{op: "sync", worker: "b", active: true},
+				{op: "sync", worker: "a"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, ModeLeader, tt.steps)
+		})
+	}
+}
+
+func TestSharded(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "single worker owns every shard",
+			steps: []step{
+				{op: "sync", worker: "a", active: true, shards: []int{0, 1, 2, 3}},
+			},
+		},
+		{
+			name: "worker joins",
+			steps: []step{
+				{op: "sync", worker: "a", active: true, shards: []int{0, 1, 2, 3}},
+				// b ranks second but a still holds its shards until a syncs.
+				{op: "sync", worker: "b", shards: []int{}},
+				{op: "sync", worker: "a", active: true, shards: []int{0, 2}},
+				{op: "sync", worker: "b", active: true, shards: []int{1, 3}},
+			},
+		},
+		{
+			name: "worker leaves",
+			steps: []step{
+				{op: "sync", worker: "a", active: true, shards: []int{0, 1, 2, 3}},
+				{op: "sync", worker: "b", shards: []int{}},
+				{op: "sync", worker: "a", active: true, shards: []int{0, 2}},
+				{op: "sync", worker: "b", active: true, shards: []int{1, 3}},
+				{op: "release", worker: "a"},
+				{op: "sync", worker: "b", active: true, shards: []int{0, 1, 2, 3}},
+			},
+		},
+		{
+			name: "crashed worker's leases expire",
+			steps: []step{
+				{op: "sync", worker: "a", active: true, shards: []int{0, 1, 2, 3}},
+				{op: "sync", worker: "b", shards: []int{}},
+				{op: "sync", worker: "a", active: true, shards: []int{0, 2}},
+				{op: "sync", worker: "b", active: true, shards: []int{1, 3}},
+				{op: "advance", advance: testTTL / 2},
+				{op: "sync", worker: "b", active: true, shards: []int{1, 3}},
+				{op: "advance", advance: testTTL/2 + time.Second},
+				// a stopped heartbeating and its shard leases ran out.
+				{op: "sync", worker: "b", active: true, shards: []int{0, 1, 2, 3}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, ModeSharded, tt.steps)
+		})
+	}
+}
+
+func TestRenewReportsLostLease(t *testing.T) {
+	leases := newFakeLeases()
+	ctx := context.Background()
+	a, _ := New(config.Outbox{Coordination: ModeLeader, WorkerID: "a", LeaseTTL: testTTL}, leases)
+	b, _ := New(config.Outbox{Coordination: ModeLeader, WorkerID: "b", LeaseTTL: testTTL}, leases)
+
+	if got, _ := a.Sync(ctx); !got.Active {
+		t.Fatal("a did not become leader")
+	}
+	if ok, err := a.Renew(ctx); !ok || err != nil {
+		t.Fatalf("renew while leading = %t, %v", ok, err)
+	}
+	leases.now = leases.now.Add(testTTL + time.Second)
+	if got, _ := b.Sync(ctx); !got.Active {
+		t.Fatal("b did not take over the expired lease")
+	}
+	if ok, _ := a.Renew(ctx); ok {
+		t.Fatal("renew succeeded after the lease moved to b")
+	}
+}
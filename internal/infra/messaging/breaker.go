@@ -0,0 +1,200 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/nats-io/nats.go"
+)
+
+var ErrCircuitOpen = errors.New("nats: circuit breaker open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker opens after threshold consecutive publish failures, rejects
+// publishes for openTimeout, then lets halfOpenTrials probes through. A
+// successful probe closes it again; a failed one reopens it. Only errors
+// that point at the broker being unreachable count as failures (see
+// IsBrokerFailure); anything else leaves the state as it is.
+type CircuitBreaker struct {
+	mu             sync.Mutex
+	state          BreakerState
+	failures       int
+	threshold      int
+	openTimeout    time.Duration
+	halfOpenTrials int
+	inFlight       int
+	openedAt       time.Time
+	onChange       func(from, to BreakerState)
+	now            func() time.Time
+}
+
+func NewCircuitBreaker(threshold int, openTimeout time.Duration, halfOpenTrials int) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if openTimeout <= 0 {
+		openTimeout = 30 * time.Second
+	}
+	if halfOpenTrials <= 0 {
+		halfOpenTrials = 1
+	}
+	return &CircuitBreaker{
+		threshold:      threshold,
+		openTimeout:    openTimeout,
+		halfOpenTrials: halfOpenTrials,
+		now:            time.Now,
+	}
+}
+
+// OnStateChange registers fn to be called on every transition.
+func (b *CircuitBreaker) OnStateChange(fn func(from, to BreakerState)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onChange = fn
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	return b.state
+}
+
+// Capacity returns how many publishes may start now: -1 when closed
+// (unlimited), 0 when open, and the remaining probes when half-open.
+func (b *CircuitBreaker) Capacity() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	switch b.state {
+	case BreakerOpen:
+		return 0
+	case BreakerHalfOpen:
+		return b.halfOpenTrials - b.inFlight
+	default:
+		return -1
+	}
+}
+
+// Allow reserves a publish slot or returns ErrCircuitOpen. Every successful
+// Allow must be followed by Record.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	switch b.state {
+	case BreakerOpen:
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.inFlight >= b.halfOpenTrials {
+			return ErrCircuitOpen
+		}
+	}
+	b.inFlight++
+	return nil
+}
+
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inFlight > 0 {
+		b.inFlight--
+	}
+	if err != nil && !IsBrokerFailure(err) {
+		return
+	}
+	if err == nil {
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			b.transition(BreakerClosed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.transition(BreakerOpen)
+	}
+}
+
+func (b *CircuitBreaker) advance() {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		b.transition(BreakerHalfOpen)
+	}
+}
+
+func (b *CircuitBreaker) transition(to BreakerState) {
+	from := b.state
+	if from == to {
+		return
+	}
+	b.state = to
+	if to != BreakerOpen {
+		b.failures = 0
+	}
+	if b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
+
+// IsBrokerFailure reports whether err means the broker could not be reached
+// or did not answer in time. Rejected messages, unrouted subjects and
+// cancelled publishes say nothing about the broker's health.
+func IsBrokerFailure(err error) bool {
+	for _, target := range []error{
+		nats.ErrConnectionClosed,
+		nats.ErrConnectionDraining,
+		nats.ErrConnectionReconnecting,
+		nats.ErrDisconnected,
+		nats.ErrNoServers,
+		nats.ErrTimeout,
+		nats.ErrNoResponders,
+		nats.ErrNoStreamResponse,
+		context.DeadlineExceeded,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap returns a publisher that routes every Publish through b.
+func (b *CircuitBreaker) Wrap(next broker.Publisher) broker.Publisher {
+	return &breakerPublisher{breaker: b, next: next}
+}
+
+type breakerPublisher struct {
+	breaker *CircuitBreaker
+	next    broker.Publisher
+}
+
+func (p *breakerPublisher) Publish(ctx context.Context, subject string, payload []byte, msgID string, headers map[string]string) error {
+	if err := p.breaker.Allow(); err != nil {
+		return err
+	}
+	err := p.next.Publish(ctx, subject, payload, msgID, headers)
+	p.breaker.Record(err)
+	return err
+}
@@ -0,0 +1,137 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/nats-io/nats.go"
+)
+
+// newTestBreaker returns a breaker on a clock the test moves by hand.
+func newTestBreaker(threshold, trials int) (*CircuitBreaker, *time.Time) {
+	now := time.Unix(0, 0)
+	b := NewCircuitBreaker(threshold, time.Minute, trials)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func publishThrough(b *CircuitBreaker, err error) error {
+	if allowErr := b.Allow(); allowErr != nil {
+		return allowErr
+	}
+	b.Record(err)
+	return nil
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	b, now := newTestBreaker(2, 1)
+	var transitions []string
+	b.OnStateChange(func(from, to BreakerState) {
+		transitions = append(transitions, fmt.Sprintf("%s->%s", from, to))
+	})
+	outage := fmt.Errorf("publish: %w", nats.ErrNoStreamResponse)
+
+	steps := []struct {
+		name     string
+		advance  time.Duration
+		err      error
+		allowErr error
+		state    BreakerState
+		capacity int
+	}{
+		{name: "first failure stays closed", err: outage, state: BreakerClosed, capacity: -1},
+		{name: "success resets the count", err: nil, state: BreakerClosed, capacity: -1},
+		{name: "failure one of two", err: outage, state: BreakerClosed, capacity: -1},
+		{name: "failure two of two opens", err: nats.ErrTimeout, state: BreakerOpen, capacity: 0},
+		{name: "open rejects", allowErr: ErrCircuitOpen, state: BreakerOpen, capacity: 0},
+		{name: "timeout not yet over", advance: 59 * time.Second, allowErr: ErrCircuitOpen, state: BreakerOpen, capacity: 0},
+		{name: "failed probe reopens", advance: time.Second, err: nats.ErrConnectionClosed, state: BreakerOpen, capacity: 0},
+		{name: "successful probe closes", advance: time.Minute, err: nil, state: BreakerClosed, capacity: -1},
+	}
+	for _, s := range steps {
+		*now = now.Add(s.advance)
+		if err := publishThrough(b, s.err); !errors.Is(err, s.allowErr) {
+			t.Fatalf("%s: allow = %v, want %v", s.name, err, s.allowErr)
+		}
+		if got := b.State(); got != s.state {
+			t.Fatalf("%s: state %s, want %s", s.name, got, s.state)
+		}
+		if got := b.Capacity(); got != s.capacity {
+			t.Fatalf("%s: capacity %d, want %d", s.name, got, s.capacity)
+		}
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if fmt.Sprint(transitions) != fmt.Sprint(want) {
+		t.Fatalf("transitions %v, want %v", transitions, want)
+	}
+}
+
+func TestCircuitBreakerHalfOpenCapacity(t *testing.T) {
+	b, now := newTestBreaker(1, 2)
+	_ = publishThrough(b, nats.ErrTimeout)
+	*now = now.Add(time.Minute)
+
+	if got := b.Capacity(); got != 2 {
+		t.Fatalf("half-open capacity %d, want 2", got)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("first probe: %v", err)
+	}
+	if got := b.Capacity(); got != 1 {
+		t.Fatalf("capacity with one probe in flight %d, want 1", got)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("second probe: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("third probe = %v, want ErrCircuitOpen", err)
+	}
+	if got := b.Capacity(); got != 0 {
+		t.Fatalf("capacity with every probe in flight %d, want 0", got)
+	}
+	b.Record(nil)
+	if got := b.Capacity(); got != -1 {
+		t.Fatalf("capacity after a successful probe %d, want -1", got)
+	}
+}
+
+func TestCircuitBreakerIgnoresNonBrokerErrors(t *testing.T) {
+	b, _ := newTestBreaker(1, 1)
+	for _, err := range []error{
+		fmt.Errorf("%w user.unknown", broker.ErrNoStream),
+		errors.New("nats: maximum payload exceeded"),
+		context.Canceled,
+	} {
+		if allowErr := publishThrough(b, err); allowErr != nil {
+			t.Fatalf("allow after %v: %v", err, allowErr)
+		}
+		if got := b.State(); got != BreakerClosed {
+			t.Fatalf("%v opened the breaker", err)
+		}
+	}
+}
+
+// Events of unrouted types must not open the breaker and stop publishing
+// for every other event.
+func TestBreakerPublisherUnroutedSubjectKeepsBreakerClosed(t *testing.T) {
+	mem := NewMemoryBroker()
+	mem.AddStream("events", []string{"user.>"})
+	b, _ := newTestBreaker(1, 1)
+	pub := b.Wrap(mem)
+	ctx := context.Background()
+
+	if err := pub.Publish(ctx, "order.placed", []byte(`{}`), "a", nil); !errors.Is(err, broker.ErrNoStream) {
+		t.Fatalf("publish unrouted = %v, want ErrNoStream", err)
+	}
+	if err := pub.Publish(ctx, "user.created", []byte(`{}`), "b", nil); err != nil {
+		t.Fatalf("publish routed after an unrouted one: %v", err)
+	}
+	if got := b.State(); got != BreakerClosed {
+		t.Fatalf("state %s, want closed", got)
+	}
+}
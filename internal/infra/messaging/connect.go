@@ -0,0 +1,107 @@
+package messaging
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+)
+
+// serverURLs joins url and urls into the comma-separated seed list
+// nats.Connect accepts.
+func serverURLs(cfg config.NATS) string {
+	urls := make([]string, 0, len(cfg.URLs)+1)
+	if cfg.URL != "" {
+		urls = append(urls, cfg.URL)
+	}
+	urls = append(urls, cfg.URLs...)
+	return strings.Join(urls, ",")
+}
+
+func connectOptions(cfg config.NATS, log logrus.FieldLogger) ([]nats.Option, error) {
+	opts := []nats.Option{
+		nats.Name("simple-backend"),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			log.WithError(err).Warn("nats: disconnected")
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Infof("nats: reconnected to %s", nc.ConnectedUrlRedacted())
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			log.Info("nats: connection closed")
+		}),
+		nats.ErrorHandler(func(nc *nats.Conn, sub *nats.Subscription, err error) {
+			entry := log.WithError(err)
+			if sub != nil {
+				entry = entry.WithField("subject", sub.Subject)
+			}
+			entry.Warn("nats: async error")
+		}),
+	}
+	if cfg.ConnectTimeout > 0 {
+		opts = append(opts, nats.Timeout(cfg.ConnectTimeout))
+	}
+	if cfg.ReconnectWait > 0 {
+		opts = append(opts, nats.ReconnectWait(cfg.ReconnectWait))
+	}
+	if cfg.MaxReconnects != 0 {
+		opts = append(opts, nats.MaxReconnects(cfg.MaxReconnects))
+	}
+
+	methods := 0
+	if cfg.CredsFile != "" {
+		methods++
+		opts = append(opts, nats.UserCredentials(cfg.CredsFile))
+	}
+	if cfg.NKeyFile != "" {
+		methods++
+		opt, err := nats.NkeyOptionFromSeed(cfg.NKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	}
+	if cfg.Token != "" {
+		methods++
+		opts = append(opts, nats.Token(cfg.Token))
+	}
+	if cfg.User != "" {
+		methods++
+		opts = append(opts, nats.UserInfo(cfg.User, cfg.Password))
+	}
+	if methods > 1 {
+		return nil, errors.New("nats: set only one of creds_file, nkey_file, token or user")
+	}
+
+	if cfg.TLS.CAFile != "" {
+		opts = append(opts, nats.RootCAs(cfg.TLS.CAFile))
+	}
+	if cfg.TLS.CertFile != "" || cfg.TLS.KeyFile != "" {
+		if cfg.TLS.CertFile == "" || cfg.TLS.KeyFile == "" {
+			return nil, errors.New("nats: tls cert_file and key_file must be set together")
+		}
+		opts = append(opts, nats.ClientCert(cfg.TLS.CertFile, cfg.TLS.KeyFile))
+	}
+	return opts, nil
+}
+
+// Status reports the connection state, e.g. CONNECTED or RECONNECTING.
+func (c *NATSClient) Status() string {
+	if c == nil || c.conn == nil {
+		return "DISCONNECTED"
+	}
+	return c.conn.Status().String()
+}
+
+// Healthy returns an error unless the connection is up.
+func (c *NATSClient) Healthy() error {
+	if c == nil || c.conn == nil {
+		return errors.New("nats: not connected")
+	}
+	if !c.conn.IsConnected() {
+		return errors.New("nats: " + strings.ToLower(c.conn.Status().String()))
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/nats-io/nats.go"
+)
+
+var ErrRecreateRequired = errors.New("consumer config change requires recreating the durable")
+
+// ReconcileOptions governs the rare changes that cannot be applied in
+// place. A recreated durable loses its ack floor, so it starts from an
+// explicit stream sequence or time instead of replaying or skipping.
+type ReconcileOptions struct {
+	AllowRecreate bool
+	StartSequence uint64
+	StartTime     time.Time
+}
+
+// Reconciliation reports what EnsureConsumer did.
+type Reconciliation struct {
+	Action  string // created, updated, recreated or unchanged
+	Changes []string
+}
+
+// EnsureConsumer makes the durable match cfg. Mutable fields are updated in
+// place, keeping the durable's delivery state.
+func EnsureConsumer(ctx context.Context, js nats.JetStreamContext, stream string, cfg broker.SubscriptionConfig, opts ReconcileOptions) (Reconciliation, error) {
+	if stream == "" {
+		return Reconciliation{}, errors.New("nats stream is required")
+	}
+	if cfg.Durable == "" {
+		return Reconciliation{}, errors.New("nats consumer durable is required")
+	}
+	if len(cfg.Subjects) == 0 {
+		return Reconciliation{}, errors.New("nats consumer subjects are required")
+	}
+
+	desired := desiredConfig(cfg)
+	info, err := js.ConsumerInfo(stream, cfg.Durable, nats.Context(ctx))
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		if _, err := js.AddConsumer(stream, &desired, nats.Context(ctx)); err != nil {
+			return Reconciliation{}, err
+		}
+		return Reconciliation{Action: "created"}, nil
+	}
+	if err != nil {
+		return Reconciliation{}, err
+	}
+
+	if immutable := immutableChanges(info.Config, desired); len(immutable) > 0 {
+		return recreate(ctx, js, stream, info, desired, immutable, opts)
+	}
+	updated, changes := applyMutable(info.Config, desired)
+	if len(changes) == 0 {
+		return Reconciliation{Action: "unchanged"}, nil
+	}
+	if _, err := js.UpdateConsumer(stream, &updated, nats.Context(ctx)); err != nil {
+		if !opts.AllowRecreate {
+			return Reconciliation{}, fmt.Errorf("update %s %v: %w", cfg.Durable, changes, err)
+		}
+		return recreate(ctx, js, stream, info, desired, changes, opts)
+	}
+	return Reconciliation{Action: "updated", Changes: changes}, nil
+}
+
+func desiredConfig(cfg broker.SubscriptionConfig) nats.ConsumerConfig {
+	maxDeliver := cfg.MaxDeliver
+	if maxDeliver <= 0 {
+		maxDeliver = -1
+	}
+	desired := nats.ConsumerConfig{
+		Durable:       cfg.Durable,
+		AckPolicy:     nats.AckExplicitPolicy,
+		ReplayPolicy:  nats.ReplayInstantPolicy,
+		AckWait:       cfg.AckWait,
+		MaxAckPending: cfg.MaxAckPending,
+		MaxDeliver:    maxDeliver,
+		BackOff:       cfg.Backoff,
+	}
+	if len(cfg.Subjects) == 1 {
+		desired.FilterSubject = cfg.Subjects[0]
+	} else {
+		desired.FilterSubjects = cfg.Subjects
+	}
+	return desired
+}
+
+// immutableChanges lists differences the server refuses to update. The
+// deliver policy and start position are not declared: a durable keeps the
+// ones it was created (or recreated) with, so they never differ here.
+func immutableChanges(current, desired nats.ConsumerConfig) []string {
+	var changes []string
+	if current.AckPolicy != desired.AckPolicy {
+		changes = append(changes, "ack_policy")
+	}
+	if current.ReplayPolicy != desired.ReplayPolicy {
+		changes = append(changes, "replay_policy")
+	}
+	if current.DeliverSubject != desired.DeliverSubject {
+		changes = append(changes, "push->pull")
+	}
+	if current.Heartbeat != desired.Heartbeat {
+		changes = append(changes, "idle_heartbeat")
+	}
+	if current.FlowControl != desired.FlowControl {
+		changes = append(changes, "flow_control")
+	}
+	if desired.MaxWaiting > 0 && current.MaxWaiting != desired.MaxWaiting {
+		changes = append(changes, "max_waiting")
+	}
+	return changes
+}
+
+// applyMutable copies the mutable fields of desired onto the server's
+// config. Zero desired values keep the server's value.
+func applyMutable(current, desired nats.ConsumerConfig) (nats.ConsumerConfig, []string) {
+	updated := current
+	var changes []string
+	if desired.AckWait > 0 && current.AckWait != desired.AckWait {
+		updated.AckWait = desired.AckWait
+		changes = append(changes, "ack_wait")
+	}
+	if desired.MaxAckPending > 0 && current.MaxAckPending != desired.MaxAckPending {
+		updated.MaxAckPending = desired.MaxAckPending
+		changes = append(changes, "max_ack_pending")
+	}
+	if current.MaxDeliver != desired.MaxDeliver {
+		updated.MaxDeliver = desired.MaxDeliver
+		changes = append(changes, "max_deliver")
+	}
+	if !slices.Equal(current.BackOff, desired.BackOff) {
+		updated.BackOff = desired.BackOff
+		changes = append(changes, "backoff")
+	}
+	if !sameFilters(filters(current), filters(desired)) {
+		updated.FilterSubject = desired.FilterSubject
+		updated.FilterSubjects = desired.FilterSubjects
+		changes = append(changes, "filter_subjects")
+	}
+	return updated, changes
+}
+
+func recreate(ctx context.Context, js nats.JetStreamContext, stream string, info *nats.ConsumerInfo, desired nats.ConsumerConfig, changes []string, opts ReconcileOptions) (Reconciliation, error) {
+	if !opts.AllowRecreate {
+		return Reconciliation{}, fmt.Errorf("%w: %s %v (ack floor at stream sequence %d; rerun with --allow-recreate and --start-seq or --start-time)",
+			ErrRecreateRequired, desired.Durable, changes, info.AckFloor.Stream)
+	}
+	switch {
+	case opts.StartSequence > 0:
+		desired.DeliverPolicy = nats.DeliverByStartSequencePolicy
+		desired.OptStartSeq = opts.StartSequence
+	case !opts.StartTime.IsZero():
+		start := opts.StartTime
+		desired.DeliverPolicy = nats.DeliverByStartTimePolicy
+		desired.OptStartTime = &start
+	default:
+		return Reconciliation{}, fmt.Errorf("%w: %s: a start sequence or start time is required (ack floor at stream sequence %d)",
+			ErrRecreateRequired, desired.Durable, info.AckFloor.Stream)
+	}
+	if err := js.DeleteConsumer(stream, desired.Durable, nats.Context(ctx)); err != nil {
+		return Reconciliation{}, err
+	}
+	if _, err := js.AddConsumer(stream, &desired, nats.Context(ctx)); err != nil {
+		return Reconciliation{}, err
+	}
+	return Reconciliation{Action: "recreated", Changes: changes}, nil
+}
+
+func filters(c nats.ConsumerConfig) []string {
+	if len(c.FilterSubjects) > 0 {
+		return c.FilterSubjects
+	}
+	if c.FilterSubject != "" {
+		return []string{c.FilterSubject}
+	}
+	return nil
+}
+
+func sameFilters(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
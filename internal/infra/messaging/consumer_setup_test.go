@@ -0,0 +1,256 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/nats-io/nats.go"
+)
+
+// fakeJS holds one durable and records the calls reconciliation makes.
+// Methods it does not override panic through the nil embedded interface.
+type fakeJS struct {
+	nats.JetStreamContext
+	info      *nats.ConsumerInfo
+	updateErr error
+	calls     []string
+	applied   *nats.ConsumerConfig
+}
+
+func (f *fakeJS) ConsumerInfo(stream, name string, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	if f.info == nil {
+		return nil, nats.ErrConsumerNotFound
+	}
+	return f.info, nil
+}
+
+func (f *fakeJS) AddConsumer(stream string, cfg *nats.ConsumerConfig, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	f.calls = append(f.calls, "add")
+	f.applied = cfg
+	return &nats.ConsumerInfo{Config: *cfg}, nil
+}
+
+func (f *fakeJS) UpdateConsumer(stream string, cfg *nats.ConsumerConfig, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	f.calls = append(f.calls, "update")
+	if f.updateErr != nil {
+		return nil, f.updateErr
+	}
+	f.applied = cfg
+	return &nats.ConsumerInfo{Config: *cfg}, nil
+}
+
+func (f *fakeJS) DeleteConsumer(stream, consumer string, opts ...nats.JSOpt) error {
+	f.calls = append(f.calls, "delete")
+	return nil
+}
+
+func testSubscription() broker.SubscriptionConfig {
+	return broker.SubscriptionConfig{
+		Durable:       "audit",
+		Subjects:      []string{"user.created", "user.updated"},
+		AckWait:       30 * time.Second,
+		MaxAckPending: 100,
+		MaxDeliver:    5,
+		Backoff:       []time.Duration{time.Second, 5 * time.Second},
+	}
+}
+
+// serverConfig is the durable as the server reports it after creation,
+// with the defaults it fills in.
+func serverConfig() nats.ConsumerConfig {
+	cfg := desiredConfig(testSubscription())
+	cfg.MaxWaiting = 512
+	return cfg
+}
+
+func TestDesiredConfig(t *testing.T) {
+	cfg := testSubscription()
+	got := desiredConfig(cfg)
+	if got.AckPolicy != nats.AckExplicitPolicy || got.DeliverSubject != "" {
+		t.Fatalf("want an explicit-ack pull consumer, got %+v", got)
+	}
+	if got.FilterSubject != "" || !reflect.DeepEqual(got.FilterSubjects, cfg.Subjects) {
+		t.Fatalf("filters = %q %v", got.FilterSubject, got.FilterSubjects)
+	}
+
+	cfg.Subjects, cfg.MaxDeliver = []string{"user.>"}, 0
+	got = desiredConfig(cfg)
+	if got.FilterSubject != "user.>" || got.FilterSubjects != nil {
+		t.Fatalf("single subject should use filter_subject, got %q %v", got.FilterSubject, got.FilterSubjects)
+	}
+	if got.MaxDeliver != -1 {
+		t.Fatalf("max_deliver = %d, want -1 (unlimited)", got.MaxDeliver)
+	}
+}
+
+func TestImmutableChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*nats.ConsumerConfig)
+		want   []string
+	}{
+		{name: "server defaults", mutate: func(*nats.ConsumerConfig) {}},
+		{name: "mutable fields only", mutate: func(c *nats.ConsumerConfig) { c.AckWait, c.MaxDeliver = time.Minute, 9 }},
+		{name: "start position kept from a recreate", mutate: func(c *nats.ConsumerConfig) {
+			c.DeliverPolicy, c.OptStartSeq = nats.DeliverByStartSequencePolicy, 42
+		}},
+		{name: "ack policy", mutate: func(c *nats.ConsumerConfig) { c.AckPolicy = nats.AckAllPolicy }, want: []string{"ack_policy"}},
+		{name: "replay policy", mutate: func(c *nats.ConsumerConfig) { c.ReplayPolicy = nats.ReplayOriginalPolicy }, want: []string{"replay_policy"}},
+		{name: "push consumer", mutate: func(c *nats.ConsumerConfig) {
+			c.DeliverSubject, c.Heartbeat, c.FlowControl = "deliver.audit", 5*time.Second, true
+		}, want: []string{"push->pull", "idle_heartbeat", "flow_control"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := serverConfig()
+			tt.mutate(&current)
+			got := immutableChanges(current, desiredConfig(testSubscription()))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("changes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	desired := desiredConfig(testSubscription())
+	desired.MaxWaiting = 64
+	if got := immutableChanges(serverConfig(), desired); !reflect.DeepEqual(got, []string{"max_waiting"}) {
+		t.Fatalf("declared max_waiting: changes = %v", got)
+	}
+}
+
+func TestApplyMutable(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*broker.SubscriptionConfig)
+		want   []string
+		check  func(*testing.T, nats.ConsumerConfig)
+	}{
+		{name: "unchanged", mutate: func(*broker.SubscriptionConfig) {}},
+		{name: "filter order ignored", mutate: func(c *broker.SubscriptionConfig) {
+			c.Subjects = []string{"user.updated", "user.created"}
+		}},
+		{name: "zero values keep the server's", mutate: func(c *broker.SubscriptionConfig) {
+			c.AckWait, c.MaxAckPending = 0, 0
+		}, check: func(t *testing.T, got nats.ConsumerConfig) {
+			if got.AckWait != 30*time.Second || got.MaxAckPending != 100 {
+				t.Fatalf("ack_wait %s max_ack_pending %d, want the server's", got.AckWait, got.MaxAckPending)
+			}
+		}},
+		{name: "tuning", mutate: func(c *broker.SubscriptionConfig) {
+			c.AckWait, c.MaxAckPending, c.MaxDeliver = time.Minute, 50, 0
+			c.Backoff = nil
+		}, want: []string{"ack_wait", "max_ack_pending", "max_deliver", "backoff"}, check: func(t *testing.T, got nats.ConsumerConfig) {
+			if got.AckWait != time.Minute || got.MaxAckPending != 50 || got.MaxDeliver != -1 || got.BackOff != nil {
+				t.Fatalf("not applied: %+v", got)
+			}
+		}},
+		{name: "filters", mutate: func(c *broker.SubscriptionConfig) {
+			c.Subjects = []string{"user.>"}
+		}, want: []string{"filter_subjects"}, check: func(t *testing.T, got nats.ConsumerConfig) {
+			if got.FilterSubject != "user.>" || got.FilterSubjects != nil {
+				t.Fatalf("filters = %q %v", got.FilterSubject, got.FilterSubjects)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testSubscription()
+			tt.mutate(&cfg)
+			current := serverConfig()
+			got, changes := applyMutable(current, desiredConfig(cfg))
+			if !reflect.DeepEqual(changes, tt.want) {
+				t.Fatalf("changes = %v, want %v", changes, tt.want)
+			}
+			if got.MaxWaiting != current.MaxWaiting {
+				t.Fatalf("server-only field max_waiting changed to %d", got.MaxWaiting)
+			}
+			if tt.check != nil {
+				tt.check(t, got)
+			}
+		})
+	}
+}
+
+func TestEnsureConsumer(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	pushConsumer := func() *nats.ConsumerInfo {
+		cfg := serverConfig()
+		cfg.DeliverSubject = "deliver.audit"
+		return &nats.ConsumerInfo{Config: cfg, AckFloor: nats.SequenceInfo{Stream: 41}}
+	}
+	tests := []struct {
+		name      string
+		info      *nats.ConsumerInfo
+		updateErr error
+		opts      ReconcileOptions
+		action    string
+		calls     []string
+		err       error
+		check     func(*testing.T, *nats.ConsumerConfig)
+	}{
+		{name: "missing durable is created", action: "created", calls: []string{"add"}},
+		{name: "matching durable is left alone", info: &nats.ConsumerInfo{Config: serverConfig()}, action: "unchanged"},
+		{name: "mutable change is updated in place", info: func() *nats.ConsumerInfo {
+			cfg := serverConfig()
+			cfg.AckWait = time.Minute
+			return &nats.ConsumerInfo{Config: cfg}
+		}(), action: "updated", calls: []string{"update"}},
+		{name: "immutable change needs --allow-recreate", info: pushConsumer(), err: ErrRecreateRequired},
+		{name: "recreate needs a start position", info: pushConsumer(), opts: ReconcileOptions{AllowRecreate: true}, err: ErrRecreateRequired},
+		{name: "recreate from a stream sequence", info: pushConsumer(),
+			opts:   ReconcileOptions{AllowRecreate: true, StartSequence: 42},
+			action: "recreated", calls: []string{"delete", "add"},
+			check: func(t *testing.T, cfg *nats.ConsumerConfig) {
+				if cfg.DeliverPolicy != nats.DeliverByStartSequencePolicy || cfg.OptStartSeq != 42 || cfg.DeliverSubject != "" {
+					t.Fatalf("recreated with %+v", cfg)
+				}
+			}},
+		{name: "recreate from a time", info: pushConsumer(),
+			opts:   ReconcileOptions{AllowRecreate: true, StartTime: start},
+			action: "recreated", calls: []string{"delete", "add"},
+			check: func(t *testing.T, cfg *nats.ConsumerConfig) {
+				if cfg.DeliverPolicy != nats.DeliverByStartTimePolicy || cfg.OptStartTime == nil || !cfg.OptStartTime.Equal(start) {
+					t.Fatalf("recreated with %+v", cfg)
+				}
+			}},
+		{name: "rejected update without --allow-recreate", info: func() *nats.ConsumerInfo {
+			cfg := serverConfig()
+			cfg.FilterSubject, cfg.FilterSubjects = "user.>", nil
+			return &nats.ConsumerInfo{Config: cfg}
+		}(), updateErr: errors.New("filter subjects overlap"), calls: []string{"update"}},
+		{name: "rejected update is recreated when allowed", info: func() *nats.ConsumerInfo {
+			cfg := serverConfig()
+			cfg.FilterSubject, cfg.FilterSubjects = "user.>", nil
+			return &nats.ConsumerInfo{Config: cfg}
+		}(), updateErr: errors.New("filter subjects overlap"),
+			opts:   ReconcileOptions{AllowRecreate: true, StartSequence: 1},
+			action: "recreated", calls: []string{"update", "delete", "add"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &fakeJS{info: tt.info, updateErr: tt.updateErr}
+			got, err := EnsureConsumer(context.Background(), js, "EVENTS", testSubscription(), tt.opts)
+			switch {
+			case tt.err != nil && !errors.Is(err, tt.err):
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			case tt.err == nil && tt.action == "" && err == nil:
+				t.Fatal("want an error")
+			case tt.action != "" && err != nil:
+				t.Fatalf("ensure: %v", err)
+			}
+			if got.Action != tt.action {
+				t.Fatalf("action = %q, want %q", got.Action, tt.action)
+			}
+			if !reflect.DeepEqual(js.calls, tt.calls) {
+				t.Fatalf("calls = %v, want %v", js.calls, tt.calls)
+			}
+			if tt.check != nil {
+				tt.check(t, js.applied)
+			}
+		})
+	}
+}
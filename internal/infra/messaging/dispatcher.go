@@ -0,0 +1,105 @@
+package messaging
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/persistence"
+	"github.com/sirupsen/logrus"
+)
+
+// OutboxDispatcher publishes selected outbox events straight after the
+// transaction that wrote them commits. Each event is claimed first so the
+// outbox worker does not publish it concurrently; events that cannot be
+// claimed or fail to publish are left to the worker.
+type OutboxDispatcher struct {
+	publisher   broker.Publisher
+	natsCfg     config.NATS
+	repo        *persistence.OutboxRepository
+	eventTypes  map[string]bool
+	timeout     time.Duration
+	maxAttempts int
+	log         logrus.FieldLogger
+	wg          sync.WaitGroup
+}
+
+var _ persistence.OutboxDispatcher = (*OutboxDispatcher)(nil)
+
+// NewOutboxDispatcher dispatches the outboxCfg.DirectDispatch event types.
+func NewOutboxDispatcher(publisher broker.Publisher, natsCfg config.NATS, outboxCfg config.Outbox, repo *persistence.OutboxRepository, log logrus.FieldLogger) *OutboxDispatcher {
+	types := make(map[string]bool, len(outboxCfg.DirectDispatch))
+	for _, t := range outboxCfg.DirectDispatch {
+		types[t] = true
+	}
+	timeout := outboxCfg.DirectDispatchTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &OutboxDispatcher{
+		publisher:   publisher,
+		natsCfg:     natsCfg,
+		repo:        repo,
+		eventTypes:  types,
+		timeout:     timeout,
+		maxAttempts: outboxCfg.MaxAttempts,
+		log:         log,
+	}
+}
+
+func (d *OutboxDispatcher) Dispatch(ctx context.Context, events []entity.OutboxEvent) {
+	selected := make([]entity.OutboxEvent, 0, len(events))
+	for _, event := range events {
+		if d.eventTypes[event.EventType] || d.eventTypes["*"] {
+			selected = append(selected, event)
+		}
+	}
+	if len(selected) == 0 {
+		return
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), d.timeout)
+		defer cancel()
+		for _, event := range selected {
+			if !d.publish(ctx, event) {
+				return
+			}
+		}
+	}()
+}
+
+// Wait blocks until in-flight dispatches finish.
+func (d *OutboxDispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// publish reports whether later events of the batch may still be
+// dispatched; after a failure they are left to the worker to keep order.
+func (d *OutboxDispatcher) publish(ctx context.Context, event entity.OutboxEvent) bool {
+	entry := d.log.WithFields(logrus.Fields{"event_id": event.ID, "event_type": event.EventType})
+	claimed, err := d.repo.ClaimByID(ctx, event.ID, d.maxAttempts)
+	if err != nil {
+		entry.WithError(err).Warn("outbox-dispatch: claim failed")
+		return false
+	}
+	if !claimed {
+		return false
+	}
+	if err := PublishOutboxEvent(ctx, d.publisher, d.natsCfg, event); err != nil {
+		entry.WithError(err).Warn("outbox-dispatch: publish failed, leaving event to outbox-worker")
+		if err := d.repo.MarkFailed(ctx, event.ID, err.Error()); err != nil {
+			entry.WithError(err).Warn("outbox-dispatch: mark failed")
+		}
+		return false
+	}
+	if err := d.repo.MarkProcessed(ctx, event.ID); err != nil {
+		entry.WithError(err).Warn("outbox-dispatch: mark processed")
+	}
+	return true
+}
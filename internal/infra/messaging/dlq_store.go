@@ -0,0 +1,253 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/consumer"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/nats-io/nats.go"
+)
+
+// Replay headers. A replayed message carries them into the live stream and,
+// if it fails again, back into the DLQ, which is how replay loops are cut.
+const (
+	HeaderReplayCount  = "X-DLQ-Replay-Count"
+	HeaderReplayedFrom = "X-DLQ-Replayed-From"
+)
+
+var (
+	ErrReplayLimit     = errors.New("dlq: replay limit reached")
+	ErrNoOriginSubject = errors.New("dlq: original subject missing")
+	ErrNotDLQEntry     = errors.New("dlq: not a dead-lettered message")
+)
+
+// DLQEntry is a message stored in the DLQ stream.
+type DLQEntry struct {
+	Sequence   uint64
+	Subject    string
+	StoredAt   time.Time
+	Data       []byte
+	Headers    map[string]string
+	DeadLetter consumer.DeadLetter
+}
+
+// FailedAt is the envelope failure time, or the storage time for entries
+// written before the envelope existed.
+func (e DLQEntry) FailedAt() time.Time {
+	if !e.DeadLetter.FailedAt.IsZero() {
+		return e.DeadLetter.FailedAt
+	}
+	return e.StoredAt
+}
+
+func (e DLQEntry) ReplayCount() int {
+	n, _ := strconv.Atoi(e.Headers[HeaderReplayCount])
+	return n
+}
+
+// DLQFilter selects DLQ entries. Zero fields match everything.
+type DLQFilter struct {
+	Sequences []uint64
+	Subject   string
+	Since     time.Time
+	Until     time.Time
+	Error     string
+	Limit     int
+}
+
+func (f DLQFilter) matches(e DLQEntry) bool {
+	if f.Subject != "" && !broker.SubjectMatches(f.Subject, e.DeadLetter.Subject) {
+		return false
+	}
+	failedAt := e.FailedAt()
+	if !f.Since.IsZero() && failedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && failedAt.After(f.Until) {
+		return false
+	}
+	if f.Error != "" && !strings.Contains(strings.ToLower(e.DeadLetter.Error), strings.ToLower(f.Error)) {
+		return false
+	}
+	return true
+}
+
+// DLQStore reads and edits the DLQ stream. Browsing uses direct message
+// access or a short-lived ordered consumer, and never moves the delivery
+// state of a durable.
+type DLQStore struct {
+	js       nats.JetStreamContext
+	stream   string
+	subjects map[string]bool
+}
+
+// NewDLQStore opens the DLQ in stream. When the stream also holds live
+// subjects, only messages on subjects are treated as DLQ entries.
+func NewDLQStore(js nats.JetStreamContext, stream string, subjects []string) *DLQStore {
+	set := make(map[string]bool, len(subjects))
+	for _, s := range subjects {
+		set[s] = true
+	}
+	return &DLQStore{js: js, stream: stream, subjects: set}
+}
+
+// List returns the entries matching filter in stream order. Without
+// explicit sequences it reads the DLQ subjects through an ephemeral ordered
+// consumer, so a DLQ sharing the live stream is not scanned message by
+// message.
+func (s *DLQStore) List(ctx context.Context, filter DLQFilter) ([]DLQEntry, error) {
+	if len(filter.Sequences) == 0 {
+		return s.scan(ctx, filter)
+	}
+	var entries []DLQEntry
+	for _, seq := range filter.Sequences {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entry, err := s.Get(ctx, seq)
+		if errors.Is(err, nats.ErrMsgNotFound) || errors.Is(err, ErrNotDLQEntry) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !filter.matches(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+		if filter.Limit > 0 && len(entries) >= filter.Limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// scan delivers every message on the DLQ subjects, starting at filter.Since
+// when set: an entry is always stored after it failed.
+func (s *DLQStore) scan(ctx context.Context, filter DLQFilter) ([]DLQEntry, error) {
+	subjects := make([]string, 0, len(s.subjects))
+	for subject := range s.subjects {
+		subjects = append(subjects, subject)
+	}
+	if len(subjects) == 0 {
+		return nil, nil
+	}
+	info, err := s.js.StreamInfo(s.stream, &nats.StreamInfoRequest{SubjectsFilter: ">"}, nats.Context(ctx))
+	if err != nil {
+		return nil, err
+	}
+	var stored uint64
+	for _, subject := range subjects {
+		stored += info.State.Subjects[subject]
+	}
+	if stored == 0 {
+		return nil, nil
+	}
+
+	start := nats.DeliverAll()
+	if !filter.Since.IsZero() {
+		start = nats.StartTime(filter.Since)
+	}
+	sub, err := s.js.SubscribeSync("", nats.BindStream(s.stream), nats.ConsumerFilterSubjects(subjects...),
+		nats.OrderedConsumer(), start, nats.Context(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+
+	var entries []DLQEntry
+	for {
+		// Entries deleted while scanning never arrive; a quiet consumer means
+		// the end of the DLQ was reached.
+		msgCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		msg, err := sub.NextMsgWithContext(msgCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				return entries, nil
+			}
+			return nil, err
+		}
+		md, err := msg.Metadata()
+		if err != nil {
+			return nil, err
+		}
+		entry := newDLQEntry(md.Sequence.Stream, msg.Subject, md.Timestamp, msg.Data, msg.Header)
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+			if filter.Limit > 0 && len(entries) >= filter.Limit {
+				return entries, nil
+			}
+		}
+		if md.NumPending == 0 {
+			return entries, nil
+		}
+	}
+}
+
+// Get reads one entry. Sequences holding live messages of a shared stream
+// return ErrNotDLQEntry.
+func (s *DLQStore) Get(ctx context.Context, seq uint64) (DLQEntry, error) {
+	raw, err := s.js.GetMsg(s.stream, seq, nats.Context(ctx))
+	if err != nil {
+		return DLQEntry{}, err
+	}
+	if !s.subjects[raw.Subject] {
+		return DLQEntry{}, fmt.Errorf("%w: sequence %d is on %s", ErrNotDLQEntry, seq, raw.Subject)
+	}
+	return newDLQEntry(raw.Sequence, raw.Subject, raw.Time, raw.Data, raw.Header), nil
+}
+
+func newDLQEntry(seq uint64, subject string, storedAt time.Time, data []byte, header nats.Header) DLQEntry {
+	headers := make(map[string]string, len(header))
+	for k, values := range header {
+		if len(values) > 0 {
+			headers[k] = values[0]
+		}
+	}
+	return DLQEntry{
+		Sequence:   seq,
+		Subject:    subject,
+		StoredAt:   storedAt,
+		Data:       data,
+		Headers:    headers,
+		DeadLetter: consumer.ParseDeadLetter(headers),
+	}
+}
+
+func (s *DLQStore) Delete(ctx context.Context, seq uint64) error {
+	return s.js.DeleteMsg(s.stream, seq, nats.Context(ctx))
+}
+
+// Replay republishes e to its original subject with its original headers.
+// Entries already replayed maxReplays times are refused with
+// ErrReplayLimit; maxReplays <= 0 disables the check.
+func (s *DLQStore) Replay(ctx context.Context, publisher broker.Publisher, e DLQEntry, maxReplays int) error {
+	subject := e.DeadLetter.Subject
+	if subject == "" {
+		return ErrNoOriginSubject
+	}
+	count := e.ReplayCount()
+	if maxReplays > 0 && count >= maxReplays {
+		return fmt.Errorf("%w (%d)", ErrReplayLimit, count)
+	}
+
+	headers := make(map[string]string, len(e.Headers))
+	for k, v := range e.Headers {
+		if !strings.HasPrefix(k, "X-DLQ-") && k != nats.MsgIdHdr {
+			headers[k] = v
+		}
+	}
+	headers[HeaderReplayCount] = strconv.Itoa(count + 1)
+	headers[HeaderReplayedFrom] = fmt.Sprintf("%s:%d", s.stream, e.Sequence)
+	msgID := fmt.Sprintf("replay-%s-%d", s.stream, e.Sequence)
+	return publisher.Publish(ctx, subject, e.Data, msgID, headers)
+}
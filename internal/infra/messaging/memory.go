@@ -0,0 +1,364 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+)
+
+// memoryDuplicateWindow matches the JetStream default.
+const memoryDuplicateWindow = 2 * time.Minute
+
+// MemoryBroker keeps streams and durables in process. It follows the
+// JetStream semantics the consumers rely on: message IDs are deduplicated,
+// unacked deliveries come back after the ack wait (or the backoff step),
+// Nak redelivers after a delay, Term and MaxDeliver drop the message, and
+// MaxAckPending caps the outstanding deliveries. Nothing survives a restart.
+type MemoryBroker struct {
+	mu      sync.Mutex
+	streams map[string]*memoryStream
+	changed chan struct{}
+}
+
+type memoryStream struct {
+	name     string
+	subjects []string
+	msgs     []memoryMsg
+	ids      map[string]time.Time
+	durables map[string]*memoryDurable
+}
+
+type memoryMsg struct {
+	seq       uint64
+	subject   string
+	data      []byte
+	headers   map[string]string
+	timestamp time.Time
+}
+
+type memoryDurable struct {
+	cfg     broker.SubscriptionConfig
+	next    int
+	pending map[uint64]*memoryPending
+}
+
+type memoryPending struct {
+	msg       memoryMsg
+	delivered uint64
+	deadline  time.Time
+}
+
+var (
+	_ broker.Publisher  = (*MemoryBroker)(nil)
+	_ broker.Subscriber = (*memorySubscriber)(nil)
+)
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		streams: make(map[string]*memoryStream),
+		changed: make(chan struct{}),
+	}
+}
+
+// AddStream declares a stream capturing subjects. Declaring it again
+// replaces its subjects and keeps the stored messages.
+func (b *MemoryBroker) AddStream(name string, subjects []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s, ok := b.streams[name]; ok {
+		s.subjects = subjects
+		return
+	}
+	b.streams[name] = &memoryStream{
+		name:     name,
+		subjects: subjects,
+		ids:      make(map[string]time.Time),
+		durables: make(map[string]*memoryDurable),
+	}
+}
+
+// Subscriber opens durables on stream.
+func (b *MemoryBroker) Subscriber(stream string) broker.Subscriber {
+	return &memorySubscriber{broker: b, stream: stream}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, subject string, payload []byte, msgID string, headers map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.capture(subject)
+	if s == nil {
+		return fmt.Errorf("%w %s", broker.ErrNoStream, subject)
+	}
+	now := time.Now()
+	for id, at := range s.ids {
+		if now.Sub(at) > memoryDuplicateWindow {
+			delete(s.ids, id)
+		}
+	}
+	if msgID != "" {
+		if _, dup := s.ids[msgID]; dup {
+			return nil
+		}
+		s.ids[msgID] = now
+	}
+	copied := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		if v != "" {
+			copied[k] = v
+		}
+	}
+	if msgID != "" {
+		copied[broker.HeaderMsgID] = msgID
+	}
+	s.msgs = append(s.msgs, memoryMsg{
+		seq:       uint64(len(s.msgs)) + 1,
+		subject:   subject,
+		data:      append([]byte(nil), payload...),
+		headers:   copied,
+		timestamp: now,
+	})
+	b.notify()
+	return nil
+}
+
+func (b *MemoryBroker) capture(subject string) *memoryStream {
+	names := make([]string, 0, len(b.streams))
+	for name := range b.streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, pattern := range b.streams[name].subjects {
+			if broker.SubjectMatches(pattern, subject) {
+				return b.streams[name]
+			}
+		}
+	}
+	return nil
+}
+
+// notify wakes every waiting Fetch. The caller holds mu.
+func (b *MemoryBroker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+type memorySubscriber struct {
+	broker *MemoryBroker
+	stream string
+}
+
+// Subscribe creates the durable on first use, starting at the beginning of
+// the stream, and otherwise applies cfg to it in place.
+func (s *memorySubscriber) Subscribe(ctx context.Context, cfg broker.SubscriptionConfig) (broker.Subscription, error) {
+	b := s.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stream, ok := b.streams[s.stream]
+	if !ok {
+		return nil, fmt.Errorf("memory broker: stream %s not found", s.stream)
+	}
+	if d, ok := stream.durables[cfg.Durable]; ok {
+		d.cfg = cfg
+	} else {
+		stream.durables[cfg.Durable] = &memoryDurable{cfg: cfg, pending: make(map[uint64]*memoryPending)}
+	}
+	return &memorySubscription{broker: b, stream: stream, durable: stream.durables[cfg.Durable]}, nil
+}
+
+type memorySubscription struct {
+	broker  *MemoryBroker
+	stream  *memoryStream
+	durable *memoryDurable
+}
+
+func (s *memorySubscription) Fetch(ctx context.Context, n int) ([]broker.Delivery, error) {
+	for {
+		s.broker.mu.Lock()
+		deliveries, wake := s.collect(n, time.Now())
+		changed := s.broker.changed
+		s.broker.mu.Unlock()
+		if len(deliveries) > 0 {
+			return deliveries, nil
+		}
+
+		var (
+			timer *time.Timer
+			due   <-chan time.Time
+		)
+		if !wake.IsZero() {
+			timer = time.NewTimer(time.Until(wake))
+			due = timer.C
+		}
+		select {
+		case <-changed:
+		case <-due:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, broker.ErrTimeout
+			}
+			return nil, err
+		}
+	}
+}
+
+// collect hands out up to n deliveries, redeliveries first, and returns the
+// earliest time a pending message becomes due again. The caller holds mu.
+func (s *memorySubscription) collect(n int, now time.Time) ([]broker.Delivery, time.Time) {
+	d := s.durable
+	var (
+		out  []broker.Delivery
+		wake time.Time
+	)
+	seqs := make([]uint64, 0, len(d.pending))
+	for seq := range d.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, seq := range seqs {
+		p := d.pending[seq]
+		if p.deadline.After(now) {
+			if wake.IsZero() || p.deadline.Before(wake) {
+				wake = p.deadline
+			}
+			continue
+		}
+		if d.cfg.MaxDeliver > 0 && int(p.delivered) >= d.cfg.MaxDeliver {
+			delete(d.pending, seq)
+			continue
+		}
+		if len(out) < n {
+			out = append(out, s.deliver(p, now))
+		}
+	}
+	for len(out) < n && d.next < len(s.stream.msgs) {
+		if d.cfg.MaxAckPending > 0 && len(d.pending) >= d.cfg.MaxAckPending {
+			break
+		}
+		msg := s.stream.msgs[d.next]
+		d.next++
+		if !d.matches(msg.subject) {
+			continue
+		}
+		p := &memoryPending{msg: msg}
+		d.pending[msg.seq] = p
+		out = append(out, s.deliver(p, now))
+	}
+	return out, wake
+}
+
+func (s *memorySubscription) deliver(p *memoryPending, now time.Time) broker.Delivery {
+	p.delivered++
+	p.deadline = now.Add(s.durable.ackWait(p.delivered))
+	headers := make(map[string]string, len(p.msg.headers))
+	for k, v := range p.msg.headers {
+		headers[k] = v
+	}
+	return &memoryDelivery{
+		sub:       s,
+		msg:       p.msg,
+		headers:   headers,
+		delivered: p.delivered,
+	}
+}
+
+func (s *memorySubscription) Close() error {
+	return nil
+}
+
+func (d *memoryDurable) matches(subject string) bool {
+	if len(d.cfg.Subjects) == 0 {
+		return true
+	}
+	for _, pattern := range d.cfg.Subjects {
+		if broker.SubjectMatches(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// ackWait follows the backoff steps when set, like JetStream does.
+func (d *memoryDurable) ackWait(delivered uint64) time.Duration {
+	if len(d.cfg.Backoff) > 0 {
+		idx := min(int(delivered)-1, len(d.cfg.Backoff)-1)
+		return d.cfg.Backoff[max(idx, 0)]
+	}
+	if d.cfg.AckWait > 0 {
+		return d.cfg.AckWait
+	}
+	return 30 * time.Second
+}
+
+type memoryDelivery struct {
+	sub       *memorySubscription
+	msg       memoryMsg
+	headers   map[string]string
+	delivered uint64
+}
+
+func (d *memoryDelivery) Subject() string            { return d.msg.subject }
+func (d *memoryDelivery) Data() []byte               { return d.msg.data }
+func (d *memoryDelivery) Headers() map[string]string { return maps.Clone(d.headers) }
+
+func (d *memoryDelivery) Metadata() (broker.Metadata, error) {
+	return broker.Metadata{
+		Stream:       d.sub.stream.name,
+		Sequence:     d.msg.seq,
+		NumDelivered: d.delivered,
+		Timestamp:    d.msg.timestamp,
+	}, nil
+}
+
+func (d *memoryDelivery) Ack() error {
+	return d.settle(func(p *memoryPending) bool { return true })
+}
+
+func (d *memoryDelivery) Term() error {
+	return d.settle(func(p *memoryPending) bool { return true })
+}
+
+func (d *memoryDelivery) Nak(delay time.Duration) error {
+	return d.settle(func(p *memoryPending) bool {
+		p.deadline = time.Now().Add(delay)
+		return false
+	})
+}
+
+func (d *memoryDelivery) InProgress() error {
+	return d.settle(func(p *memoryPending) bool {
+		p.deadline = time.Now().Add(d.sub.durable.ackWait(d.delivered))
+		return false
+	})
+}
+
+// settle applies fn to the pending entry unless it was redelivered since,
+// removing it when fn returns true.
+func (d *memoryDelivery) settle(fn func(p *memoryPending) bool) error {
+	b := d.sub.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := d.sub.durable.pending[d.msg.seq]
+	if !ok || p.delivered != d.delivered {
+		return errors.New("memory broker: delivery already settled or redelivered")
+	}
+	if fn(p) {
+		delete(d.sub.durable.pending, d.msg.seq)
+	}
+	b.notify()
+	return nil
+}
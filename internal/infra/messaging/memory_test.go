@@ -0,0 +1,158 @@
+package messaging
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+)
+
+func newMemoryTestBroker(t *testing.T) *MemoryBroker {
+	t.Helper()
+	mem := NewMemoryBroker()
+	mem.AddStream("events", []string{"user.>"})
+	return mem
+}
+
+func publish(t *testing.T, mem *MemoryBroker, subject, msgID string) {
+	t.Helper()
+	if err := mem.Publish(context.Background(), subject, []byte(`{}`), msgID, nil); err != nil {
+		t.Fatalf("publish %s: %v", msgID, err)
+	}
+}
+
+func subscribe(t *testing.T, mem *MemoryBroker, cfg broker.SubscriptionConfig) broker.Subscription {
+	t.Helper()
+	sub, err := mem.Subscriber("events").Subscribe(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	return sub
+}
+
+// fetch waits up to wait for at most n deliveries; none is not an error.
+func fetch(t *testing.T, sub broker.Subscription, n int, wait time.Duration) []broker.Delivery {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	out, err := sub.Fetch(ctx, n)
+	if err == broker.ErrTimeout {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	return out
+}
+
+func TestMemoryBrokerDeduplicatesWithinWindow(t *testing.T) {
+	mem := newMemoryTestBroker(t)
+	publish(t, mem, "user.created", "a")
+	publish(t, mem, "user.created", "a")
+	publish(t, mem, "user.created", "b")
+	publish(t, mem, "user.created", "")
+	publish(t, mem, "user.created", "")
+
+	if got := len(fetchAll(t, mem.Subscriber("events"), broker.SubscriptionConfig{Durable: "within"})); got != 4 {
+		t.Fatalf("got %d messages, want 4", got)
+	}
+
+	// Once the window has passed, the same ID is stored again.
+	mem.mu.Lock()
+	mem.streams["events"].ids["a"] = time.Now().Add(-memoryDuplicateWindow - time.Second)
+	mem.mu.Unlock()
+	publish(t, mem, "user.created", "a")
+	if got := len(mem.streams["events"].msgs); got != 5 {
+		t.Fatalf("stored %d messages after the window, want 5", got)
+	}
+}
+
+func TestMemoryBrokerNakDelaysRedelivery(t *testing.T) {
+	mem := newMemoryTestBroker(t)
+	publish(t, mem, "user.created", "a")
+	sub := subscribe(t, mem, broker.SubscriptionConfig{Durable: "nak", AckWait: time.Minute})
+
+	first := fetch(t, sub, 1, time.Second)
+	if len(first) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(first))
+	}
+	if err := first[0].Nak(100 * time.Millisecond); err != nil {
+		t.Fatalf("nak: %v", err)
+	}
+	if early := fetch(t, sub, 1, 30*time.Millisecond); len(early) != 0 {
+		t.Fatal("redelivered before the nak delay")
+	}
+	again := fetch(t, sub, 1, time.Second)
+	if len(again) != 1 {
+		t.Fatal("not redelivered after the nak delay")
+	}
+	if md, _ := again[0].Metadata(); md.NumDelivered != 2 {
+		t.Fatalf("NumDelivered = %d, want 2", md.NumDelivered)
+	}
+	if err := first[0].Ack(); err == nil {
+		t.Fatal("ack of a superseded delivery succeeded")
+	}
+}
+
+func TestMemoryBrokerRedeliversAfterAckWait(t *testing.T) {
+	mem := newMemoryTestBroker(t)
+	publish(t, mem, "user.created", "a")
+	sub := subscribe(t, mem, broker.SubscriptionConfig{Durable: "ackwait", AckWait: 50 * time.Millisecond})
+
+	if got := fetch(t, sub, 1, time.Second); len(got) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(got))
+	}
+	again := fetch(t, sub, 1, time.Second)
+	if len(again) != 1 {
+		t.Fatal("not redelivered after the ack wait")
+	}
+	if err := again[0].Ack(); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if got := fetch(t, sub, 1, 100*time.Millisecond); len(got) != 0 {
+		t.Fatal("redelivered after ack")
+	}
+}
+
+func TestMemoryBrokerDropsAfterMaxDeliver(t *testing.T) {
+	mem := newMemoryTestBroker(t)
+	publish(t, mem, "user.created", "a")
+	sub := subscribe(t, mem, broker.SubscriptionConfig{Durable: "maxdeliver", AckWait: 20 * time.Millisecond, MaxDeliver: 2})
+
+	for i := 1; i <= 2; i++ {
+		got := fetch(t, sub, 1, time.Second)
+		if len(got) != 1 {
+			t.Fatalf("delivery %d missing", i)
+		}
+		if md, _ := got[0].Metadata(); md.NumDelivered != uint64(i) {
+			t.Fatalf("NumDelivered = %d, want %d", md.NumDelivered, i)
+		}
+	}
+	if got := fetch(t, sub, 1, 100*time.Millisecond); len(got) != 0 {
+		t.Fatal("delivered past MaxDeliver")
+	}
+}
+
+func TestMemoryBrokerCapsAckPending(t *testing.T) {
+	mem := newMemoryTestBroker(t)
+	for _, id := range []string{"a", "b", "c"} {
+		publish(t, mem, "user.created", id)
+	}
+	sub := subscribe(t, mem, broker.SubscriptionConfig{Durable: "ackpending", AckWait: time.Minute, MaxAckPending: 2})
+
+	first := fetch(t, sub, 10, time.Second)
+	if len(first) != 2 {
+		t.Fatalf("got %d deliveries, want 2", len(first))
+	}
+	if got := fetch(t, sub, 10, 30*time.Millisecond); len(got) != 0 {
+		t.Fatal("delivered past MaxAckPending")
+	}
+	if err := first[0].Ack(); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	rest := fetch(t, sub, 10, time.Second)
+	if len(rest) != 1 || rest[0].Headers()[broker.HeaderMsgID] != "c" {
+		t.Fatalf("got %d deliveries after ack, want message c", len(rest))
+	}
+}
@@ -4,44 +4,114 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"time"
+	"fmt"
+	"strings"
 
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/cloudevents"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/events"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/outbox"
 	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
 )
 
 type NATSClient struct {
-	conn *nats.Conn
-	js   nats.JetStreamContext
-	cfg  config.NATS
+	conn     *nats.Conn
+	js       nats.JetStreamContext
+	cfg      config.NATS
+	subjects []string
 }
 
-func NewNATS(ctx context.Context, cfg config.NATS) (*NATSClient, error) {
-	if cfg.URL == "" {
+var _ broker.Publisher = (*NATSClient)(nil)
+
+// NewNATS connects and reconciles the declared streams. Safe stream changes
+// are applied; destructive ones are logged and left for the stream command.
+func NewNATS(ctx context.Context, cfg config.NATS, log logrus.FieldLogger) (*NATSClient, error) {
+	client, err := Dial(ctx, cfg, log)
+	if err != nil || client == nil {
+		return client, err
+	}
+	if err := client.ReconcileStreams(ctx, log); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// Dial connects to NATS without touching any stream.
+func Dial(ctx context.Context, cfg config.NATS, log logrus.FieldLogger) (*NATSClient, error) {
+	urls := serverURLs(cfg)
+	if urls == "" {
 		return nil, nil
 	}
 	if cfg.Stream == "" || cfg.UserCreatedSubject == "" {
 		return nil, errors.New("nats: stream and user_created_subject are required")
 	}
+	switch cfg.CloudEvents.Mode {
+	case "", "none", cloudevents.ModeBinary, cloudevents.ModeStructured:
+	default:
+		return nil, fmt.Errorf("nats: cloudevents mode %q: supported values are binary, structured or none", cfg.CloudEvents.Mode)
+	}
+	switch cfg.Encoding {
+	case "", "json", "protobuf":
+	default:
+		return nil, fmt.Errorf("nats: encoding %q: supported values are json or protobuf", cfg.Encoding)
+	}
 
-	conn, err := nats.Connect(cfg.URL, nats.Name("simple-backend"))
+	opts, err := connectOptions(cfg, log)
 	if err != nil {
 		return nil, err
 	}
-
-	js, err := conn.JetStream()
+	conn, err := nats.Connect(urls, opts...)
 	if err != nil {
-		conn.Close()
 		return nil, err
 	}
 
-	if err := ensureStream(ctx, js, cfg); err != nil {
+	js, err := conn.JetStream()
+	if err != nil {
 		conn.Close()
 		return nil, err
 	}
 
-	return &NATSClient{conn: conn, js: js, cfg: cfg}, nil
+	return &NATSClient{
+		conn:     conn,
+		js:       js,
+		cfg:      cfg,
+		subjects: append(streamSubjects(cfg), DLQSubjects(cfg)...),
+	}, nil
+}
+
+// ReconcileStreams creates missing streams and applies safe changes to
+// existing ones.
+func (c *NATSClient) ReconcileStreams(ctx context.Context, log logrus.FieldLogger) error {
+	streams, err := DesiredStreams(c.cfg)
+	if err != nil {
+		return err
+	}
+	for _, desired := range streams {
+		plan, err := PlanStream(ctx, c.js, desired)
+		if err != nil {
+			return err
+		}
+		if plan.Destructive() {
+			log.Warnf("nats: stream %s has destructive changes %v; run `stream apply --allow-destructive` to apply them", desired.Name, plan.Changes)
+			plan = plan.Safe()
+		}
+		if plan.Empty() {
+			continue
+		}
+		if err := ApplyStream(ctx, c.js, plan, false); err != nil {
+			return fmt.Errorf("nats: stream %s: %w", desired.Name, err)
+		}
+		if plan.Create {
+			log.Infof("nats: stream %s created", desired.Name)
+		} else {
+			log.Infof("nats: stream %s updated %v", desired.Name, plan.Changes)
+		}
+	}
+	return nil
 }
 
 func (c *NATSClient) Close() {
@@ -58,77 +128,183 @@ func (c *NATSClient) JetStream() nats.JetStreamContext {
 	return c.js
 }
 
-func (c *NATSClient) PublishUserCreated(ctx context.Context, user entity.User) error {
+func (c *NATSClient) Publish(ctx context.Context, subject string, payload []byte, msgID string, headers map[string]string) error {
 	if c == nil {
 		return nil
 	}
 	if c.js == nil {
 		return errors.New("nats: jetstream not initialized")
 	}
-	payload := struct {
-		ID        string    `json:"id"`
-		Name      string    `json:"name"`
-		Email     string    `json:"email"`
-		CreatedAt time.Time `json:"created_at"`
-	}{
-		ID:        user.ID.String(),
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
+	// JetStream answers a subject no stream captures with the same no
+	// responders error as a stream that is down; checking the declared
+	// subjects first keeps an unrouted event type from looking like an
+	// outage.
+	if !c.captures(subject) {
+		return fmt.Errorf("%w %s", broker.ErrNoStream, subject)
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = payload
+	for k, v := range headers {
+		if v != "" {
+			msg.Header.Set(k, v)
+		}
+	}
+	if msgID != "" {
+		msg.Header.Set(broker.HeaderMsgID, msgID)
 	}
+	_, err := c.js.PublishMsg(msg, nats.Context(ctx))
+	return err
+}
 
-	data, err := json.Marshal(payload)
-	if err != nil {
-		return err
+func (c *NATSClient) captures(subject string) bool {
+	for _, pattern := range c.subjects {
+		if broker.SubjectMatches(pattern, subject) {
+			return true
+		}
 	}
+	return false
+}
 
-	return c.Publish(ctx, c.cfg.UserCreatedSubject, data, user.ID.String())
+// SubjectFor maps an outbox event type to the subject it is published on.
+// Unknown event types are published on a subject named after the type.
+func SubjectFor(cfg config.NATS, eventType string) string {
+	subjects := map[string]string{
+		"user.created":       cfg.UserCreatedSubject,
+		"user.updated":       cfg.UserUpdatedSubject,
+		"user.deleted":       cfg.UserDeletedSubject,
+		"user.email_changed": cfg.UserEmailSubject,
+	}
+	if subject := subjects[eventType]; subject != "" {
+		return subject
+	}
+	return eventType
 }
 
-func (c *NATSClient) Publish(ctx context.Context, subject string, payload []byte, msgID string) error {
-	if c == nil {
-		return nil
+// streamSubjects lists the live stream's subjects. Without a dedicated DLQ
+// stream, the DLQ subjects are captured by the live stream as well.
+func streamSubjects(cfg config.NATS) []string {
+	candidates := []string{cfg.UserCreatedSubject, cfg.UserUpdatedSubject, cfg.UserDeletedSubject, cfg.UserEmailSubject}
+	if cfg.DLQStream == "" {
+		candidates = append(candidates, DLQSubjects(cfg)...)
 	}
-	if c.js == nil {
-		return errors.New("nats: jetstream not initialized")
+	return uniqueSubjects(candidates)
+}
+
+// DLQSubjects lists every configured dead-letter subject.
+func DLQSubjects(cfg config.NATS) []string {
+	candidates := []string{cfg.DLQSubject}
+	for _, c := range cfg.Consumers {
+		candidates = append(candidates, c.DLQSubject)
 	}
-	msg := nats.NewMsg(subject)
-	msg.Data = payload
-	if msgID != "" {
-		msg.Header.Set(nats.MsgIdHdr, msgID)
+	return uniqueSubjects(candidates)
+}
+
+// DLQStream names the stream holding the DLQ subjects.
+func DLQStream(cfg config.NATS) string {
+	if cfg.DLQStream != "" {
+		return cfg.DLQStream
 	}
-	_, err := c.js.PublishMsg(msg, nats.Context(ctx))
-	return err
+	return cfg.Stream
 }
 
-func ensureStream(ctx context.Context, js nats.JetStreamContext, cfg config.NATS) error {
-	info, err := js.StreamInfo(cfg.Stream, nats.Context(ctx))
-	if err == nil {
-		subjects := []string{cfg.UserCreatedSubject}
-		if cfg.DLQSubject != "" {
-			subjects = append(subjects, cfg.DLQSubject)
-		}
-		if !sameSubjects(info.Config.Subjects, subjects) {
-			info.Config.Subjects = subjects
-			_, err = js.UpdateStream(&info.Config, nats.Context(ctx))
+func uniqueSubjects(candidates []string) []string {
+	var subjects []string
+	seen := map[string]bool{}
+	for _, subject := range candidates {
+		if subject != "" && !seen[subject] {
+			seen[subject] = true
+			subjects = append(subjects, subject)
 		}
+	}
+	return subjects
+}
+
+// PublishOutboxEvent publishes an outbox row on its routed subject with the
+// stored headers. The outbox ID is the message ID, so a row published by
+// both the API server and the worker is deduplicated by the broker.
+func PublishOutboxEvent(ctx context.Context, pub broker.Publisher, cfg config.NATS, event entity.OutboxEvent) error {
+	payload, headers, err := EncodeOutboxEvent(cfg, event)
+	if err != nil {
 		return err
 	}
+	return pub.Publish(ctx, SubjectFor(cfg, event.EventType), payload, event.ID.String(), headers)
+}
 
-	if errors.Is(err, nats.ErrStreamNotFound) {
-		subjects := []string{cfg.UserCreatedSubject}
-		if cfg.DLQSubject != "" {
-			subjects = append(subjects, cfg.DLQSubject)
+// EncodeOutboxEvent wraps an outbox row in the configured CloudEvents
+// envelope. The outbox headers are kept next to the envelope so consumers
+// can route and order without decoding it.
+func EncodeOutboxEvent(cfg config.NATS, event entity.OutboxEvent) ([]byte, map[string]string, error) {
+	headers := OutboxHeaders(event)
+	payload, contentType, err := outboxPayload(cfg.Encoding, event, headers[outbox.HeaderSchemaVersion])
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.CloudEvents.Mode == "none" {
+		headers[cloudevents.HeaderContentType] = contentType
+		return payload, headers, nil
+	}
+	data, ceHeaders, err := cloudevents.Encode(cloudevents.Event{
+		ID:              event.ID.String(),
+		Source:          cfg.CloudEvents.Source,
+		Type:            event.EventType,
+		Subject:         event.AggregateID.String(),
+		Time:            event.CreatedAt,
+		DataSchema:      dataSchema(cfg.CloudEvents.DataSchema, event.EventType, headers[outbox.HeaderSchemaVersion]),
+		DataContentType: contentType,
+		Data:            payload,
+	}, cfg.CloudEvents.Mode)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range ceHeaders {
+		headers[k] = v
+	}
+	return data, headers, nil
+}
+
+// outboxPayload returns the event data in the requested encoding. Rows
+// stored as protobuf are converted back to JSON when JSON is requested, and
+// event types without a protobuf message are always sent as JSON.
+func outboxPayload(encoding string, event entity.OutboxEvent, versionHeader string) ([]byte, string, error) {
+	version, err := events.ParseVersion(versionHeader)
+	if err != nil {
+		return nil, "", err
+	}
+	if event.PayloadRaw != nil {
+		if encoding == "protobuf" {
+			return event.PayloadRaw, events.ContentTypeProtobuf, nil
 		}
-		_, err = js.AddStream(&nats.StreamConfig{
-			Name:      cfg.Stream,
-			Subjects:  subjects,
-			Storage:   nats.FileStorage,
-			Retention: nats.LimitsPolicy,
-		}, nats.Context(ctx))
-		return err
+		data, err := events.FromProto(event.EventType, version, event.PayloadRaw)
+		return data, cloudevents.ContentTypeJSON, err
 	}
-	return err
+	if encoding == "protobuf" && events.HasProto(event.EventType, version) {
+		data, err := events.ToProto(event.EventType, version, event.Payload)
+		return data, events.ContentTypeProtobuf, err
+	}
+	return event.Payload, cloudevents.ContentTypeJSON, nil
+}
+
+func dataSchema(template, eventType, version string) string {
+	return strings.NewReplacer("{type}", eventType, "{version}", version).Replace(template)
+}
+
+// OutboxHeaders returns the headers stored with the event plus the envelope
+// headers identifying the event and its aggregate.
+func OutboxHeaders(event entity.OutboxEvent) map[string]string {
+	headers := map[string]string{}
+	if len(event.Headers) > 0 {
+		if err := json.Unmarshal(event.Headers, &headers); err != nil {
+			headers = map[string]string{}
+		}
+	}
+	headers[outbox.HeaderEventID] = event.ID.String()
+	headers[outbox.HeaderEventType] = event.EventType
+	headers[outbox.HeaderAggregateType] = event.AggregateType
+	headers[outbox.HeaderAggregateID] = event.AggregateID.String()
+	if headers[outbox.HeaderSchemaVersion] == "" {
+		headers[outbox.HeaderSchemaVersion] = outbox.DefaultSchemaVersion
+	}
+	return headers
 }
 
 func sameSubjects(a, b []string) bool {
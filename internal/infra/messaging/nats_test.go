@@ -0,0 +1,79 @@
+package messaging
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Every event of an aggregate must reach the stream: the message ID is the
+// outbox event ID, never the aggregate ID, so only a republish of the same
+// row is deduplicated.
+func TestPublishOutboxEventDeduplicatesByEventID(t *testing.T) {
+	mem := NewMemoryBroker()
+	mem.AddStream("events", []string{"user.>"})
+	cfg := config.NATS{
+		UserCreatedSubject: "user.created",
+		UserUpdatedSubject: "user.updated",
+		UserDeletedSubject: "user.deleted",
+		CloudEvents:        config.CloudEvents{Mode: "none"},
+	}
+	ctx := context.Background()
+
+	aggregateID := uuid.New()
+	var published []entity.OutboxEvent
+	for _, eventType := range []string{"user.created", "user.updated", "user.deleted"} {
+		event := entity.OutboxEvent{
+			ID:          uuid.New(),
+			AggregateID: aggregateID,
+			EventType:   eventType,
+			Payload:     datatypes.JSON(`{}`),
+			CreatedAt:   time.Now(),
+		}
+		if err := PublishOutboxEvent(ctx, mem, cfg, event); err != nil {
+			t.Fatalf("publish %s: %v", eventType, err)
+		}
+		published = append(published, event)
+	}
+	if err := PublishOutboxEvent(ctx, mem, cfg, published[0]); err != nil {
+		t.Fatalf("republish: %v", err)
+	}
+
+	deliveries := fetchAll(t, mem.Subscriber("events"), broker.SubscriptionConfig{Durable: "test"})
+	if len(deliveries) != len(published) {
+		t.Fatalf("got %d messages, want %d", len(deliveries), len(published))
+	}
+	for i, d := range deliveries {
+		if got, want := d.Headers()[broker.HeaderMsgID], published[i].ID.String(); got != want {
+			t.Errorf("message %d: %s = %q, want %q", i, broker.HeaderMsgID, got, want)
+		}
+		if got, want := d.Subject(), published[i].EventType; got != want {
+			t.Errorf("message %d: subject %q, want %q", i, got, want)
+		}
+	}
+}
+
+// fetchAll drains what cfg's durable can currently receive.
+func fetchAll(t *testing.T, sub broker.Subscriber, cfg broker.SubscriptionConfig) []broker.Delivery {
+	t.Helper()
+	s, err := sub.Subscribe(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	var out []broker.Delivery
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		batch, err := s.Fetch(ctx, 100)
+		cancel()
+		if err != nil {
+			return out
+		}
+		out = append(out, batch...)
+	}
+}
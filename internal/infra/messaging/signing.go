@@ -0,0 +1,85 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/signing"
+)
+
+// NewSigner loads the signing key from cfg. It returns nil when no key
+// file is configured, which disables signing.
+func NewSigner(cfg config.Signing) (*signing.Signer, error) {
+	if cfg.KeyFile == "" {
+		return nil, nil
+	}
+	if cfg.KeyID == "" {
+		return nil, errors.New("nats: signing key_id is required with key_file")
+	}
+	key, err := loadKey(cfg.KeyID, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return signing.NewSigner(key)
+}
+
+// NewVerifier loads the trusted keys from cfg. It returns nil when there
+// are none, which disables verification; otherwise signatures are required
+// unless cfg.AllowUnsigned is set.
+func NewVerifier(cfg config.Signing) (*signing.Verifier, error) {
+	var keys []signing.Key
+	if cfg.KeyFile != "" {
+		key, err := loadKey(cfg.KeyID, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	for _, k := range cfg.VerifyKeys {
+		key, err := loadKey(k.ID, k.File)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return signing.NewVerifier(!cfg.AllowUnsigned, keys...)
+}
+
+func loadKey(id, file string) (signing.Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return signing.Key{}, fmt.Errorf("nats: signing key %s: %w", id, err)
+	}
+	return signing.ParseKey(id, data)
+}
+
+// SignedPublisher signs every message before handing it to next. A nil
+// signer returns next unchanged.
+func SignedPublisher(next broker.Publisher, signer *signing.Signer) broker.Publisher {
+	if signer == nil {
+		return next
+	}
+	return &signedPublisher{next: next, signer: signer}
+}
+
+type signedPublisher struct {
+	next   broker.Publisher
+	signer *signing.Signer
+}
+
+func (p *signedPublisher) Publish(ctx context.Context, subject string, payload []byte, msgID string, headers map[string]string) error {
+	signed := maps.Clone(headers)
+	if signed == nil {
+		signed = map[string]string{}
+	}
+	p.signer.Sign(subject, payload, signed)
+	return p.next.Publish(ctx, subject, payload, msgID, signed)
+}
@@ -0,0 +1,100 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/signing"
+)
+
+// writeKeys writes a new Ed25519 key pair to files and returns their paths.
+func writeKeys(t *testing.T) (private, public string) {
+	t.Helper()
+	priv, pub, err := signing.GenerateKey(signing.AlgorithmEd25519)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	dir := t.TempDir()
+	private, public = filepath.Join(dir, "signing.pem"), filepath.Join(dir, "signing.pub.pem")
+	if err := os.WriteFile(private, priv, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(public, pub, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return private, public
+}
+
+func TestNewVerifier(t *testing.T) {
+	private, public := writeKeys(t)
+	unsigned := map[string]string{"X-Event-Type": "user.created"}
+
+	if v, err := NewVerifier(config.Signing{}); v != nil || err != nil {
+		t.Fatalf("no keys = %v, %v; want verification disabled", v, err)
+	}
+	if _, err := NewVerifier(config.Signing{VerifyKeys: []config.SigningKey{{ID: "k1", File: filepath.Join(t.TempDir(), "missing.pem")}}}); err == nil {
+		t.Fatal("missing key file accepted")
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.Signing
+		wantErr bool
+	}{
+		{name: "trusted keys require signatures", cfg: config.Signing{VerifyKeys: []config.SigningKey{{ID: "k1", File: public}}}, wantErr: true},
+		{name: "signing key is trusted too", cfg: config.Signing{KeyID: "k1", KeyFile: private}, wantErr: true},
+		{name: "allow_unsigned for a rollout", cfg: config.Signing{VerifyKeys: []config.SigningKey{{ID: "k1", File: public}}, AllowUnsigned: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewVerifier(tt.cfg)
+			if err != nil || v == nil {
+				t.Fatalf("verifier = %v, %v", v, err)
+			}
+			_, err = v.Verify("user.created", []byte(`{}`), unsigned)
+			if tt.wantErr != errors.Is(err, signing.ErrSignature) {
+				t.Fatalf("verify unsigned = %v, want rejected %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignedPublisher(t *testing.T) {
+	private, public := writeKeys(t)
+	signer, err := NewSigner(config.Signing{KeyID: "k1", KeyFile: private})
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	verifier, err := NewVerifier(config.Signing{VerifyKeys: []config.SigningKey{{ID: "k1", File: public}}})
+	if err != nil {
+		t.Fatalf("verifier: %v", err)
+	}
+	if _, err := NewSigner(config.Signing{KeyFile: private}); err == nil {
+		t.Fatal("key_file without key_id accepted")
+	}
+
+	b := newMemoryTestBroker(t)
+	sub := subscribe(t, b, broker.SubscriptionConfig{Durable: "signed"})
+	headers := map[string]string{"X-Event-Type": "user.created"}
+	if err := SignedPublisher(b, signer).Publish(context.Background(), "user.created", []byte(`{"id":1}`), "evt-1", headers); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, ok := headers[signing.HeaderSignature]; ok {
+		t.Fatal("publishing signed the caller's header map")
+	}
+
+	delivered := fetch(t, sub, 1, time.Second)
+	if len(delivered) != 1 {
+		t.Fatal("signed message not delivered")
+	}
+	msg := delivered[0]
+	if _, err := verifier.Verify(msg.Subject(), msg.Data(), msg.Headers()); err != nil {
+		t.Fatalf("verify delivered message: %v", err)
+	}
+}
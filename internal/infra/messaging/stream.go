@@ -0,0 +1,254 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/config"
+	"github.com/nats-io/nats.go"
+)
+
+var ErrDestructiveStreamChange = errors.New("nats: destructive stream change requires explicit approval")
+
+// StreamChange is one field that differs between the server and config.
+// Destructive changes can drop stored messages when applied.
+type StreamChange struct {
+	Field       string
+	From        string
+	To          string
+	Destructive bool
+}
+
+func (c StreamChange) String() string {
+	s := fmt.Sprintf("%s: %s -> %s", c.Field, c.From, c.To)
+	if c.Destructive {
+		s += " (destructive)"
+	}
+	return s
+}
+
+// StreamPlan is what it takes to bring one stream in line with config.
+type StreamPlan struct {
+	Desired nats.StreamConfig
+	Create  bool
+	Changes []StreamChange
+	current *nats.StreamConfig
+}
+
+func (p StreamPlan) Empty() bool {
+	return !p.Create && len(p.Changes) == 0
+}
+
+func (p StreamPlan) Destructive() bool {
+	for _, c := range p.Changes {
+		if c.Destructive {
+			return true
+		}
+	}
+	return false
+}
+
+// Safe drops the destructive changes from p, keeping the server's values
+// for those fields.
+func (p StreamPlan) Safe() StreamPlan {
+	if p.current == nil || !p.Destructive() {
+		return p
+	}
+	safe := StreamPlan{Desired: p.Desired, current: p.current}
+	for _, c := range p.Changes {
+		if !c.Destructive {
+			safe.Changes = append(safe.Changes, c)
+			continue
+		}
+		switch c.Field {
+		case "storage":
+			safe.Desired.Storage = p.current.Storage
+		case "max_age":
+			safe.Desired.MaxAge = p.current.MaxAge
+		case "max_bytes":
+			safe.Desired.MaxBytes = p.current.MaxBytes
+		case "max_msgs_per_subject":
+			safe.Desired.MaxMsgsPerSubject = p.current.MaxMsgsPerSubject
+		}
+	}
+	return safe
+}
+
+// DesiredStreams builds the stream configs declared in cfg, live stream
+// first so that subjects it gives up are free before the DLQ stream
+// claims them.
+func DesiredStreams(cfg config.NATS) ([]nats.StreamConfig, error) {
+	live, err := streamConfig(cfg.Stream, streamSubjects(cfg), cfg.StreamOptions)
+	if err != nil {
+		return nil, err
+	}
+	streams := []nats.StreamConfig{live}
+	if subjects := DLQSubjects(cfg); cfg.DLQStream != "" && len(subjects) > 0 {
+		opts := cfg.DLQStreamOptions
+		if opts.MaxAge == 0 {
+			opts.MaxAge = cfg.DLQMaxAge
+		}
+		dlq, err := streamConfig(cfg.DLQStream, subjects, opts)
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, dlq)
+	}
+	return streams, nil
+}
+
+func streamConfig(name string, subjects []string, opts config.StreamOptions) (nats.StreamConfig, error) {
+	sc := nats.StreamConfig{
+		Name:              name,
+		Subjects:          subjects,
+		Retention:         nats.LimitsPolicy,
+		MaxAge:            opts.MaxAge,
+		MaxBytes:          unlimited(opts.MaxBytes),
+		MaxMsgs:           -1,
+		MaxMsgsPerSubject: unlimited(opts.MaxMsgsPerSubject),
+		Replicas:          max(opts.Replicas, 1),
+		Duplicates:        opts.DuplicateWindow,
+	}
+	switch strings.ToLower(opts.Storage) {
+	case "", "file":
+		sc.Storage = nats.FileStorage
+	case "memory":
+		sc.Storage = nats.MemoryStorage
+	default:
+		return sc, fmt.Errorf("nats: stream %s: unknown storage %q", name, opts.Storage)
+	}
+	switch strings.ToLower(opts.Discard) {
+	case "", "old":
+		sc.Discard = nats.DiscardOld
+	case "new":
+		sc.Discard = nats.DiscardNew
+	default:
+		return sc, fmt.Errorf("nats: stream %s: unknown discard policy %q", name, opts.Discard)
+	}
+	switch strings.ToLower(opts.Compression) {
+	case "", "none":
+		sc.Compression = nats.NoCompression
+	case "s2":
+		sc.Compression = nats.S2Compression
+	default:
+		return sc, fmt.Errorf("nats: stream %s: unknown compression %q", name, opts.Compression)
+	}
+	return sc, nil
+}
+
+func unlimited(v int64) int64 {
+	if v <= 0 {
+		return -1
+	}
+	return v
+}
+
+// PlanStream diffs desired against the server's copy of the stream.
+func PlanStream(ctx context.Context, js nats.JetStreamContext, desired nats.StreamConfig) (StreamPlan, error) {
+	info, err := js.StreamInfo(desired.Name, nats.Context(ctx))
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		return StreamPlan{Desired: desired, Create: true}, nil
+	}
+	if err != nil {
+		return StreamPlan{}, err
+	}
+	current := info.Config
+	plan := StreamPlan{Desired: desired, current: &current}
+	add := func(field, from, to string, destructive bool) {
+		plan.Changes = append(plan.Changes, StreamChange{Field: field, From: from, To: to, Destructive: destructive})
+	}
+
+	if !sameSubjects(current.Subjects, desired.Subjects) {
+		add("subjects", strings.Join(current.Subjects, ","), strings.Join(desired.Subjects, ","), false)
+	}
+	if current.Storage != desired.Storage {
+		add("storage", current.Storage.String(), desired.Storage.String(), true)
+	}
+	if current.MaxAge != desired.MaxAge {
+		add("max_age", ageString(current.MaxAge), ageString(desired.MaxAge), shrinks(int64(current.MaxAge), int64(desired.MaxAge)))
+	}
+	if unlimited(current.MaxBytes) != desired.MaxBytes {
+		add("max_bytes", limitString(current.MaxBytes), limitString(desired.MaxBytes), shrinks(current.MaxBytes, desired.MaxBytes))
+	}
+	if unlimited(current.MaxMsgsPerSubject) != desired.MaxMsgsPerSubject {
+		add("max_msgs_per_subject", limitString(current.MaxMsgsPerSubject), limitString(desired.MaxMsgsPerSubject),
+			shrinks(current.MaxMsgsPerSubject, desired.MaxMsgsPerSubject))
+	}
+	if max(current.Replicas, 1) != desired.Replicas {
+		add("replicas", fmt.Sprint(max(current.Replicas, 1)), fmt.Sprint(desired.Replicas), false)
+	}
+	if current.Discard != desired.Discard {
+		add("discard", current.Discard.String(), desired.Discard.String(), false)
+	}
+	if desired.Duplicates > 0 && current.Duplicates != desired.Duplicates {
+		add("duplicate_window", current.Duplicates.String(), desired.Duplicates.String(), false)
+	}
+	if current.Compression != desired.Compression {
+		add("compression", current.Compression.String(), desired.Compression.String(), false)
+	}
+	return plan, nil
+}
+
+// ApplyStream carries out plan. Destructive plans are refused with
+// ErrDestructiveStreamChange unless allowDestructive is set; a storage
+// change deletes and recreates the stream.
+func ApplyStream(ctx context.Context, js nats.JetStreamContext, plan StreamPlan, allowDestructive bool) error {
+	if plan.Empty() {
+		return nil
+	}
+	if plan.Create {
+		_, err := js.AddStream(&plan.Desired, nats.Context(ctx))
+		return err
+	}
+	if plan.Destructive() && !allowDestructive {
+		return fmt.Errorf("%w: %s", ErrDestructiveStreamChange, plan.Desired.Name)
+	}
+	for _, c := range plan.Changes {
+		if c.Field == "storage" {
+			if err := js.DeleteStream(plan.Desired.Name, nats.Context(ctx)); err != nil {
+				return err
+			}
+			_, err := js.AddStream(&plan.Desired, nats.Context(ctx))
+			return err
+		}
+	}
+	// Fields the config does not manage keep the server's values.
+	updated := *plan.current
+	updated.Subjects = plan.Desired.Subjects
+	updated.MaxAge = plan.Desired.MaxAge
+	updated.MaxBytes = plan.Desired.MaxBytes
+	updated.MaxMsgsPerSubject = plan.Desired.MaxMsgsPerSubject
+	updated.Replicas = plan.Desired.Replicas
+	updated.Discard = plan.Desired.Discard
+	if plan.Desired.Duplicates > 0 {
+		updated.Duplicates = plan.Desired.Duplicates
+	}
+	updated.Compression = plan.Desired.Compression
+	_, err := js.UpdateStream(&updated, nats.Context(ctx))
+	return err
+}
+
+// shrinks reports whether a limit tightens; 0 and negative mean unlimited.
+func shrinks(from, to int64) bool {
+	if to <= 0 {
+		return false
+	}
+	return from <= 0 || to < from
+}
+
+func ageString(d time.Duration) string {
+	if d <= 0 {
+		return "unlimited"
+	}
+	return d.String()
+}
+
+func limitString(v int64) string {
+	if v <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(v)
+}
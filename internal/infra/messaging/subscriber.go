@@ -0,0 +1,103 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/broker"
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+)
+
+// JetStreamSubscriber opens pull consumers on one stream, reconciling each
+// durable with its config first.
+type JetStreamSubscriber struct {
+	js        nats.JetStreamContext
+	stream    string
+	reconcile ReconcileOptions
+	log       logrus.FieldLogger
+}
+
+var _ broker.Subscriber = (*JetStreamSubscriber)(nil)
+
+func NewJetStreamSubscriber(js nats.JetStreamContext, stream string, reconcile ReconcileOptions, log logrus.FieldLogger) *JetStreamSubscriber {
+	return &JetStreamSubscriber{js: js, stream: stream, reconcile: reconcile, log: log}
+}
+
+func (s *JetStreamSubscriber) Subscribe(ctx context.Context, cfg broker.SubscriptionConfig) (broker.Subscription, error) {
+	result, err := EnsureConsumer(ctx, s.js, s.stream, cfg, s.reconcile)
+	if err != nil {
+		return nil, err
+	}
+	if result.Action != "unchanged" {
+		s.log.Infof("nats: durable %s %s %v", cfg.Durable, result.Action, result.Changes)
+	}
+	sub, err := s.js.PullSubscribe("", cfg.Durable, nats.Bind(s.stream, cfg.Durable))
+	if err != nil {
+		return nil, err
+	}
+	return &jsSubscription{sub: sub}, nil
+}
+
+type jsSubscription struct {
+	sub *nats.Subscription
+}
+
+func (s *jsSubscription) Fetch(ctx context.Context, n int) ([]broker.Delivery, error) {
+	msgs, err := s.sub.Fetch(n, nats.Context(ctx))
+	if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		err = broker.ErrTimeout
+	}
+	deliveries := make([]broker.Delivery, 0, len(msgs))
+	for _, msg := range msgs {
+		deliveries = append(deliveries, jsDelivery{msg: msg})
+	}
+	return deliveries, err
+}
+
+func (s *jsSubscription) Close() error {
+	return s.sub.Unsubscribe()
+}
+
+type jsDelivery struct {
+	msg *nats.Msg
+}
+
+func (d jsDelivery) Subject() string { return d.msg.Subject }
+func (d jsDelivery) Data() []byte    { return d.msg.Data }
+
+func (d jsDelivery) Headers() map[string]string {
+	headers := make(map[string]string, len(d.msg.Header))
+	for k, values := range d.msg.Header {
+		if len(values) > 0 {
+			headers[k] = values[0]
+		}
+	}
+	return headers
+}
+
+func (d jsDelivery) Metadata() (broker.Metadata, error) {
+	md, err := d.msg.Metadata()
+	if err != nil {
+		return broker.Metadata{}, err
+	}
+	return broker.Metadata{
+		Stream:       md.Stream,
+		Sequence:     md.Sequence.Stream,
+		NumDelivered: md.NumDelivered,
+		Timestamp:    md.Timestamp,
+	}, nil
+}
+
+func (d jsDelivery) Ack() error { return d.msg.Ack() }
+
+func (d jsDelivery) Nak(delay time.Duration) error {
+	if delay > 0 {
+		return d.msg.NakWithDelay(delay)
+	}
+	return d.msg.Nak()
+}
+
+func (d jsDelivery) Term() error       { return d.msg.Term() }
+func (d jsDelivery) InProgress() error { return d.msg.InProgress() }
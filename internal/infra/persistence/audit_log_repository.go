@@ -2,9 +2,11 @@ package persistence
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/outbox"
 	"gorm.io/datatypes"
 )
 
@@ -16,11 +18,26 @@ func NewAuditLogRepository(db *DB) *AuditLogRepository {
 	return &AuditLogRepository{db: db}
 }
 
-func (r *AuditLogRepository) Create(ctx context.Context, eventType string, payload []byte) error {
+func (r *AuditLogRepository) Create(ctx context.Context, eventType string, payload []byte, headers map[string]string) error {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headerData, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	claimedActor := headers[outbox.HeaderClaimedActor]
+	if claimedActor == "" {
+		claimedActor = headers[outbox.HeaderLegacyActor]
+	}
 	log := entity.AuditLog{
-		EventType: eventType,
-		Payload:   datatypes.JSON(payload),
-		CreatedAt: time.Now().UTC(),
+		EventType:    eventType,
+		Payload:      datatypes.JSON(payload),
+		RequestID:    headers[outbox.HeaderRequestID],
+		TraceParent:  headers[outbox.HeaderTraceParent],
+		ClaimedActor: claimedActor,
+		Headers:      datatypes.JSON(headerData),
+		CreatedAt:    time.Now().UTC(),
 	}
 	return r.db.Write(ctx).Create(&log).Error
 }
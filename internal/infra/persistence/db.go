@@ -5,8 +5,10 @@ import (
 	"errors"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/repository"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -25,12 +27,29 @@ type Config struct {
 
 type DB struct {
 	Conn *gorm.DB
+
+	dispatcher  OutboxDispatcher
+	rawPayloads bool
+}
+
+// OutboxDispatcher publishes freshly committed outbox events without waiting
+// for the outbox worker. Dispatch must not block; anything it fails to
+// publish is left for the worker.
+type OutboxDispatcher interface {
+	Dispatch(ctx context.Context, events []entity.OutboxEvent)
 }
 
 var _ repository.Store = (*DB)(nil)
 
 type txKey struct{}
 
+type afterCommitKey struct{}
+
+type afterCommitHooks struct {
+	mu    sync.Mutex
+	hooks []func(ctx context.Context)
+}
+
 func New(ctx context.Context, cfg Config) (*DB, error) {
 	if cfg.WriteDSN == "" {
 		return nil, errors.New("db: WriteDSN is required")
@@ -45,6 +64,10 @@ func New(ctx context.Context, cfg Config) (*DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	db := &DB{Conn: gdb}
+	if err := db.registerDomainEventCallbacks(); err != nil {
+		return nil, err
+	}
 
 	readDSNs := splitDSNs(cfg.ReadDSN)
 	for i := range readDSNs {
@@ -91,7 +114,7 @@ func New(ctx context.Context, cfg Config) (*DB, error) {
 		sqlDB.SetConnMaxIdleTime(cfg.MaxConnIdleTime)
 	}
 
-	return &DB{Conn: gdb}, nil
+	return db, nil
 }
 
 func (db *DB) Close() {
@@ -130,14 +153,70 @@ func (db *DB) Read(ctx context.Context) *gorm.DB {
 	return db.Conn.WithContext(ctx).Clauses(dbresolver.Read)
 }
 
+// WithTx runs fn in a transaction carried by the returned context. When ctx
+// already carries one, fn joins it instead of opening a second transaction,
+// so repositories and outbox.Publisher calls nest inside a usecase's WithTx.
 func (db *DB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
 	if db == nil || db.Conn == nil {
 		return errors.New("db: gorm connection is not initialized")
 	}
-	return db.Conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok && tx != nil {
+		return fn(ctx)
+	}
+	hooks := &afterCommitHooks{}
+	err := db.Conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		txCtx := context.WithValue(ctx, txKey{}, tx)
+		txCtx = context.WithValue(txCtx, afterCommitKey{}, hooks)
 		return fn(txCtx)
 	})
+	if err != nil {
+		return err
+	}
+	hooks.mu.Lock()
+	pending := hooks.hooks
+	hooks.hooks = nil
+	hooks.mu.Unlock()
+	for _, hook := range pending {
+		hook(ctx)
+	}
+	return nil
+}
+
+// AfterCommit registers fn to run once the outermost WithTx carried by ctx
+// commits. It reports false, without registering, when ctx carries no
+// transaction; hooks are dropped when the transaction rolls back.
+func (db *DB) AfterCommit(ctx context.Context, fn func(ctx context.Context)) bool {
+	hooks, ok := ctx.Value(afterCommitKey{}).(*afterCommitHooks)
+	if !ok || hooks == nil {
+		return false
+	}
+	hooks.mu.Lock()
+	hooks.hooks = append(hooks.hooks, fn)
+	hooks.mu.Unlock()
+	return true
+}
+
+func (db *DB) SetOutboxDispatcher(dispatcher OutboxDispatcher) {
+	db.dispatcher = dispatcher
+}
+
+// StoreRawPayloads makes the outbox store payloads of events that have a
+// protobuf encoding as protobuf bytes in payload_raw instead of JSONB.
+func (db *DB) StoreRawPayloads(enabled bool) {
+	db.rawPayloads = enabled
+}
+
+// dispatchAfterCommit hands events to the dispatcher once the surrounding
+// transaction commits. Outside WithTx nothing is dispatched and the outbox
+// worker publishes the events as usual.
+func (db *DB) dispatchAfterCommit(ctx context.Context, events []entity.OutboxEvent) {
+	if db == nil || db.dispatcher == nil || len(events) == 0 {
+		return
+	}
+	dispatcher := db.dispatcher
+	db.AfterCommit(ctx, func(ctx context.Context) {
+		dispatcher.Dispatch(ctx, events)
+	})
 }
 
 func (db *DB) getConn(ctx context.Context) *gorm.DB {
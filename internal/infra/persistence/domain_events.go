@@ -0,0 +1,81 @@
+package persistence
+
+import (
+	"reflect"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+	"gorm.io/gorm"
+)
+
+// registerDomainEventCallbacks drains entity.EventRecorder models into
+// outbox_events after every successful create, update and delete. The insert
+// runs on the statement's connection, so it shares the statement's
+// transaction and rolls back with it.
+func (db *DB) registerDomainEventCallbacks() error {
+	flush := func(tx *gorm.DB) {
+		if rows := db.flushDomainEvents(tx); len(rows) > 0 {
+			db.dispatchAfterCommit(tx.Statement.Context, rows)
+		}
+	}
+	cb := db.Conn.Callback()
+	if err := cb.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").
+		Register("outbox:flush_domain_events", flush); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").
+		Register("outbox:flush_domain_events", flush); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").
+		Register("outbox:flush_domain_events", flush)
+}
+
+func (db *DB) flushDomainEvents(tx *gorm.DB) []entity.OutboxEvent {
+	if tx.Error != nil || tx.Statement.RowsAffected == 0 {
+		return nil
+	}
+	events := collectDomainEvents(tx.Statement.ReflectValue)
+	if len(events) == 0 {
+		return nil
+	}
+
+	rows := make([]entity.OutboxEvent, 0, len(events))
+	for _, event := range events {
+		row, err := db.newOutboxEvent(tx.Statement.Context, event.AggregateType(), event.AggregateID(), event.EventType(), event, nil)
+		if err != nil {
+			_ = tx.AddError(err)
+			return nil
+		}
+		rows = append(rows, row)
+	}
+	if err := tx.Session(&gorm.Session{NewDB: true}).Create(&rows).Error; err != nil {
+		_ = tx.AddError(err)
+		return nil
+	}
+	return rows
+}
+
+func collectDomainEvents(value reflect.Value) []entity.DomainEvent {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		var events []entity.DomainEvent
+		for i := 0; i < value.Len(); i++ {
+			events = append(events, collectDomainEvents(value.Index(i))...)
+		}
+		return events
+	case reflect.Struct:
+		if !value.CanAddr() {
+			return nil
+		}
+		if recorder, ok := value.Addr().Interface().(entity.EventRecorder); ok {
+			return recorder.PullEvents()
+		}
+	}
+	return nil
+}
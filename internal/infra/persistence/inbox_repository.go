@@ -0,0 +1,51 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+)
+
+type InboxRepository struct {
+	db *DB
+}
+
+func NewInboxRepository(db *DB) *InboxRepository {
+	return &InboxRepository{db: db}
+}
+
+// Process records the message in the inbox and runs fn in the same
+// transaction. When the message was already recorded for consumer, fn is
+// skipped and duplicate is true. fn must write through the context it is
+// given so that its side effects commit or roll back with the inbox row.
+func (r *InboxRepository) Process(ctx context.Context, entry entity.ConsumerInbox, fn func(ctx context.Context) error) (duplicate bool, err error) {
+	err = r.db.WithTx(ctx, func(ctx context.Context) error {
+		query := `
+INSERT INTO consumer_inbox (consumer, message_id, stream, sequence, subject, processed_at)
+VALUES (?, ?, ?, ?, ?, NOW())
+ON CONFLICT (consumer, message_id) DO NOTHING
+RETURNING consumer;
+`
+		var inserted []string
+		if err := r.db.Write(ctx).Raw(query, entry.Consumer, entry.MessageID, entry.Stream, entry.Sequence, entry.Subject).Scan(&inserted).Error; err != nil {
+			return err
+		}
+		if len(inserted) == 0 {
+			duplicate = true
+			return nil
+		}
+		return fn(ctx)
+	})
+	return duplicate, err
+}
+
+// Prune removes inbox entries older than cutoff. Messages redelivered after
+// that are processed again, so cutoff must be well past the stream's
+// duplicate window and the consumers' redelivery horizon.
+func (r *InboxRepository) Prune(ctx context.Context, cutoff time.Time) (int64, error) {
+	res := r.db.Write(ctx).
+		Where("processed_at < ?", cutoff).
+		Delete(&entity.ConsumerInbox{})
+	return res.RowsAffected, res.Error
+}
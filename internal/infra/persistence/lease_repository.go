@@ -0,0 +1,67 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+)
+
+type LeaseRepository struct {
+	db *DB
+}
+
+func NewLeaseRepository(db *DB) *LeaseRepository {
+	return &LeaseRepository{db: db}
+}
+
+// Acquire takes or renews the named lease for holder. It succeeds when the
+// lease is free, expired, or already held by the same holder.
+func (r *LeaseRepository) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	query := `
+INSERT INTO outbox_leases (name, holder, expires_at)
+VALUES (?, ?, NOW() + (? * INTERVAL '1 millisecond'))
+ON CONFLICT (name) DO UPDATE
+SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+WHERE outbox_leases.holder = EXCLUDED.holder OR outbox_leases.expires_at < NOW()
+RETURNING name, holder, expires_at;
+`
+	var leases []entity.OutboxLease
+	if err := r.db.Write(ctx).Raw(query, name, holder, ttl.Milliseconds()).Scan(&leases).Error; err != nil {
+		return false, err
+	}
+	return len(leases) == 1 && leases[0].Holder == holder, nil
+}
+
+func (r *LeaseRepository) Release(ctx context.Context, name, holder string) error {
+	return r.db.Write(ctx).
+		Exec(`DELETE FROM outbox_leases WHERE name = ? AND holder = ?`, name, holder).
+		Error
+}
+
+func (r *LeaseRepository) Heartbeat(ctx context.Context, workerID string) error {
+	return r.db.Write(ctx).
+		Exec(`INSERT INTO outbox_workers (worker_id, heartbeat_at) VALUES (?, NOW())
+ON CONFLICT (worker_id) DO UPDATE SET heartbeat_at = EXCLUDED.heartbeat_at`, workerID).
+		Error
+}
+
+// LiveWorkers returns the workers that sent a heartbeat within ttl, ordered
+// by worker ID so every member derives the same shard ranking.
+func (r *LeaseRepository) LiveWorkers(ctx context.Context, ttl time.Duration) ([]entity.OutboxWorker, error) {
+	var workers []entity.OutboxWorker
+	err := r.db.Write(ctx).
+		Where("heartbeat_at > NOW() - (? * INTERVAL '1 millisecond')", ttl.Milliseconds()).
+		Order("worker_id").
+		Find(&workers).Error
+	if err != nil {
+		return nil, err
+	}
+	return workers, nil
+}
+
+func (r *LeaseRepository) Leave(ctx context.Context, workerID string) error {
+	return r.db.Write(ctx).
+		Exec(`DELETE FROM outbox_workers WHERE worker_id = ?`, workerID).
+		Error
+}
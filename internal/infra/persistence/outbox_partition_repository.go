@@ -0,0 +1,167 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	outboxPartitionPrefix = "outbox_events_p"
+	outboxDefaultPart     = "outbox_events_default"
+	outboxPartitionLayout = "20060102"
+)
+
+type OutboxPartition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+type OutboxPartitionRepository struct {
+	db *DB
+}
+
+func NewOutboxPartitionRepository(db *DB) *OutboxPartitionRepository {
+	return &OutboxPartitionRepository{db: db}
+}
+
+// OutboxPartitionFor returns the daily partition that holds rows created at t.
+func OutboxPartitionFor(t time.Time) OutboxPartition {
+	from := t.UTC().Truncate(24 * time.Hour)
+	return OutboxPartition{
+		Name: outboxPartitionPrefix + from.Format(outboxPartitionLayout),
+		From: from,
+		To:   from.Add(24 * time.Hour),
+	}
+}
+
+func (r *OutboxPartitionRepository) List(ctx context.Context) ([]OutboxPartition, error) {
+	query := `
+SELECT child.relname
+FROM pg_inherits i
+JOIN pg_class parent ON parent.oid = i.inhparent
+JOIN pg_class child ON child.oid = i.inhrelid
+JOIN pg_namespace ns ON ns.oid = parent.relnamespace
+WHERE parent.relname = 'outbox_events'
+  AND ns.nspname = current_schema()
+ORDER BY child.relname;
+`
+	var names []string
+	if err := r.db.Write(ctx).Raw(query).Scan(&names).Error; err != nil {
+		return nil, err
+	}
+	partitions := make([]OutboxPartition, 0, len(names))
+	for _, name := range names {
+		if !strings.HasPrefix(name, outboxPartitionPrefix) {
+			continue
+		}
+		day, err := time.Parse(outboxPartitionLayout, strings.TrimPrefix(name, outboxPartitionPrefix))
+		if err != nil {
+			continue
+		}
+		partitions = append(partitions, OutboxPartition{Name: name, From: day, To: day.Add(24 * time.Hour)})
+	}
+	return partitions, nil
+}
+
+// Create attaches a new daily partition. Rows that already landed in the
+// default partition for that day are moved into it first, otherwise the
+// attach would be rejected; the default partition is locked against inserts
+// until the attach so none can slip in between.
+func (r *OutboxPartitionRepository) Create(ctx context.Context, p OutboxPartition) error {
+	return r.db.WithTx(ctx, func(txCtx context.Context) error {
+		tx := r.db.Write(txCtx)
+		if err := tx.Exec(fmt.Sprintf(`LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE`, outboxDefaultPart)).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s (LIKE outbox_events INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`, p.Name)).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(fmt.Sprintf(`INSERT INTO %s SELECT * FROM %s WHERE created_at >= ? AND created_at < ?`, p.Name, outboxDefaultPart), p.From, p.To).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE created_at >= ? AND created_at < ?`, outboxDefaultPart), p.From, p.To).Error; err != nil {
+			return err
+		}
+		return tx.Exec(fmt.Sprintf(`ALTER TABLE outbox_events ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`,
+			p.Name, p.From.Format(time.RFC3339), p.To.Format(time.RFC3339))).Error
+	})
+}
+
+// Expire detaches a partition and drops it, or moves it into archiveSchema
+// when one is given. Unprocessed rows, including dead events that ran out of
+// attempts, are re-inserted first and land in the default partition.
+func (r *OutboxPartitionRepository) Expire(ctx context.Context, p OutboxPartition, archiveSchema string) (int64, error) {
+	var retained int64
+	err := r.db.WithTx(ctx, func(txCtx context.Context) error {
+		tx := r.db.Write(txCtx)
+		if err := tx.Exec(fmt.Sprintf(`ALTER TABLE outbox_events DETACH PARTITION %s`, p.Name)).Error; err != nil {
+			return err
+		}
+		res := tx.Exec(fmt.Sprintf(`INSERT INTO outbox_events SELECT * FROM %s WHERE processed_at IS NULL AND cancelled_at IS NULL`, p.Name))
+		if res.Error != nil {
+			return res.Error
+		}
+		retained = res.RowsAffected
+		if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE processed_at IS NULL AND cancelled_at IS NULL`, p.Name)).Error; err != nil {
+			return err
+		}
+		if archiveSchema != "" {
+			if err := ensureSchema(tx, archiveSchema); err != nil {
+				return err
+			}
+			return tx.Exec(fmt.Sprintf(`ALTER TABLE %s SET SCHEMA %s`, p.Name, quoteIdent(archiveSchema))).Error
+		}
+		return tx.Exec(fmt.Sprintf(`DROP TABLE %s`, p.Name)).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return retained, nil
+}
+
+// PurgeDefault removes processed and cancelled rows older than cutoff from
+// the default partition, copying them into archiveSchema when one is given.
+func (r *OutboxPartitionRepository) PurgeDefault(ctx context.Context, cutoff time.Time, archiveSchema string) (int64, error) {
+	var purged int64
+	err := r.db.WithTx(ctx, func(txCtx context.Context) error {
+		tx := r.db.Write(txCtx)
+		if archiveSchema == "" {
+			res := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE (processed_at IS NOT NULL OR cancelled_at IS NOT NULL) AND created_at < ?`, outboxDefaultPart), cutoff)
+			purged = res.RowsAffected
+			return res.Error
+		}
+		if err := ensureSchema(tx, archiveSchema); err != nil {
+			return err
+		}
+		archive := quoteIdent(archiveSchema) + ".outbox_events_archive"
+		if err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (LIKE outbox_events INCLUDING DEFAULTS)`, archive)).Error; err != nil {
+			return err
+		}
+		res := tx.Exec(fmt.Sprintf(`
+WITH moved AS (
+    DELETE FROM %s
+    WHERE (processed_at IS NOT NULL OR cancelled_at IS NOT NULL) AND created_at < ?
+    RETURNING *
+)
+INSERT INTO %s SELECT * FROM moved`, outboxDefaultPart, archive), cutoff)
+		purged = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+func ensureSchema(tx *gorm.DB, schema string) error {
+	return tx.Exec(fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS %s`, quoteIdent(schema))).Error
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
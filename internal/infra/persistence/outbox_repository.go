@@ -2,10 +2,19 @@ package persistence
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/events"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/outbox"
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/repository"
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 )
 
 type OutboxRepository struct {
@@ -16,7 +25,104 @@ func NewOutboxRepository(db *DB) *OutboxRepository {
 	return &OutboxRepository{db: db}
 }
 
+var _ outbox.Publisher = (*OutboxRepository)(nil)
+
+// Enqueue writes an outbox event, joining the transaction carried by ctx if
+// there is one. payload is stored as-is when it is already encoded JSON and
+// marshalled otherwise. headers are merged over those carried by ctx (see
+// outbox.WithHeaders).
+func (r *OutboxRepository) Enqueue(ctx context.Context, aggregateType string, aggregateID uuid.UUID, eventType string, payload any, headers outbox.Headers, opts ...outbox.Option) (uuid.UUID, error) {
+	event, err := r.db.newOutboxEvent(ctx, aggregateType, aggregateID, eventType, payload, headers, opts...)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := r.db.Write(ctx).Create(&event).Error; err != nil {
+		return uuid.Nil, err
+	}
+	r.db.dispatchAfterCommit(ctx, []entity.OutboxEvent{event})
+	return event.ID, nil
+}
+
+// Cancel stops a pending event from being published. Events that were
+// already published, cancelled, or are currently claimed by a worker
+// return repository.ErrOutboxEventNotCancellable.
+func (r *OutboxRepository) Cancel(ctx context.Context, id uuid.UUID) error {
+	res := r.db.Write(ctx).
+		Exec(`UPDATE outbox_events SET cancelled_at = NOW() WHERE id = ? AND processed_at IS NULL AND cancelled_at IS NULL AND locked_at IS NULL`, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrOutboxEventNotCancellable
+	}
+	return nil
+}
+
+// ClaimByID claims a single event that is due, unlocked, unprocessed and
+// below maxAttempts, and whose aggregate has no earlier event the worker
+// could still publish. Earlier events scheduled for later or out of
+// attempts do not hold it back, as they do not in the worker's claims. It
+// returns false when the event is not claimable, for example because the
+// outbox worker already holds it or an earlier event of the aggregate has
+// not been published yet; the worker then publishes it in order.
+func (r *OutboxRepository) ClaimByID(ctx context.Context, id uuid.UUID, maxAttempts int) (bool, error) {
+	if maxAttempts <= 0 {
+		maxAttempts = 10
+	}
+	res := r.db.Write(ctx).
+		Exec(`UPDATE outbox_events SET locked_at = NOW(), attempts = attempts + 1
+WHERE id = ? AND processed_at IS NULL AND cancelled_at IS NULL AND locked_at IS NULL AND available_at <= NOW()
+  AND attempts < ?
+  AND NOT EXISTS (
+      SELECT 1
+      FROM outbox_events prior
+      WHERE prior.aggregate_id = outbox_events.aggregate_id
+        AND prior.processed_at IS NULL
+        AND prior.cancelled_at IS NULL
+        AND prior.available_at <= NOW()
+        AND prior.attempts < ?
+        AND prior.created_at < outbox_events.created_at
+  )`, id, maxAttempts, maxAttempts)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
 func (r *OutboxRepository) Claim(ctx context.Context, limit int, lockTimeout time.Duration, maxAttempts int) ([]entity.OutboxEvent, error) {
+	return r.claim(ctx, limit, lockTimeout, maxAttempts, "", nil)
+}
+
+// ClaimOrdered claims events for a coordinated worker. When shardCount is
+// positive only aggregates hashing into shards are returned. Events whose
+// aggregate still has an earlier event locked by another worker are skipped
+// so per-aggregate ordering holds while shards move between workers.
+func (r *OutboxRepository) ClaimOrdered(ctx context.Context, limit int, lockTimeout time.Duration, maxAttempts int, shardCount int, shards []int) ([]entity.OutboxEvent, error) {
+	if lockTimeout <= 0 {
+		lockTimeout = time.Minute
+	}
+	clauses := []string{`
+      AND NOT EXISTS (
+          SELECT 1
+          FROM outbox_events prior
+          WHERE prior.aggregate_id = outbox_events.aggregate_id
+            AND prior.processed_at IS NULL
+            AND prior.created_at < outbox_events.created_at
+            AND prior.locked_at >= NOW() - (? * INTERVAL '1 second')
+      )`}
+	args := []any{int(lockTimeout.Seconds())}
+	if shardCount > 0 {
+		if len(shards) == 0 {
+			return nil, nil
+		}
+		clauses = append(clauses, `
+      AND (hashtext(aggregate_id::text) & 2147483647) % ? IN ?`)
+		args = append(args, shardCount, shards)
+	}
+	return r.claim(ctx, limit, lockTimeout, maxAttempts, strings.Join(clauses, ""), args)
+}
+
+func (r *OutboxRepository) claim(ctx context.Context, limit int, lockTimeout time.Duration, maxAttempts int, filter string, filterArgs []any) ([]entity.OutboxEvent, error) {
 	if limit <= 0 {
 		limit = 100
 	}
@@ -33,22 +139,29 @@ WITH cte AS (
     SELECT id
     FROM outbox_events
     WHERE processed_at IS NULL
+      AND cancelled_at IS NULL
+      AND available_at <= NOW()
       AND attempts < ?
-      AND (locked_at IS NULL OR locked_at < NOW() - (? * INTERVAL '1 second'))
-    ORDER BY created_at
+      AND (locked_at IS NULL OR locked_at < NOW() - (? * INTERVAL '1 second'))` + filter + `
+    ORDER BY available_at, created_at
     LIMIT ?
     FOR UPDATE SKIP LOCKED
 )
 UPDATE outbox_events
 SET locked_at = NOW(), attempts = attempts + 1
 WHERE id IN (SELECT id FROM cte)
-RETURNING id, aggregate_type, aggregate_id, event_type, payload, created_at, locked_at, processed_at, attempts, last_error;
+RETURNING id, aggregate_type, aggregate_id, event_type, payload, payload_raw, headers, created_at, available_at, cancelled_at, locked_at, processed_at, attempts, last_error;
 `
 
+	args := []any{maxAttempts, lockSeconds}
+	args = append(args, filterArgs...)
+	args = append(args, limit)
+
 	var events []entity.OutboxEvent
-	if err := r.db.Write(ctx).Raw(query, maxAttempts, lockSeconds, limit).Scan(&events).Error; err != nil {
+	if err := r.db.Write(ctx).Raw(query, args...).Scan(&events).Error; err != nil {
 		return nil, err
 	}
+	sortByAvailability(events)
 	return events, nil
 }
 
@@ -63,3 +176,93 @@ func (r *OutboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, errMsg
 		Exec(`UPDATE outbox_events SET last_error = ?, locked_at = NULL WHERE id = ?`, errMsg, id).
 		Error
 }
+
+// Release unlocks claimed events that were not attempted and gives back the
+// attempt that Claim counted for them.
+func (r *OutboxRepository) Release(ctx context.Context, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Write(ctx).
+		Exec(`UPDATE outbox_events SET locked_at = NULL, attempts = GREATEST(attempts - 1, 0) WHERE id IN ? AND processed_at IS NULL`, ids).
+		Error
+}
+
+func sortByAvailability(events []entity.OutboxEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].AvailableAt.Equal(events[j].AvailableAt) {
+			return events[i].AvailableAt.Before(events[j].AvailableAt)
+		}
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+}
+
+func (db *DB) newOutboxEvent(ctx context.Context, aggregateType string, aggregateID uuid.UUID, eventType string, payload any, headers outbox.Headers, opts ...outbox.Option) (entity.OutboxEvent, error) {
+	data, err := encodePayload(payload)
+	if err != nil {
+		return entity.OutboxEvent{}, err
+	}
+	merged := outbox.HeadersFrom(ctx)
+	for k, v := range headers {
+		merged[k] = v
+	}
+	if v, ok := payload.(events.Versioned); ok {
+		merged[outbox.HeaderSchemaVersion] = strconv.Itoa(v.SchemaVersion())
+	}
+	if merged[outbox.HeaderSchemaVersion] == "" {
+		merged[outbox.HeaderSchemaVersion] = outbox.DefaultSchemaVersion
+	}
+	version, err := events.ParseVersion(merged[outbox.HeaderSchemaVersion])
+	if err != nil {
+		return entity.OutboxEvent{}, err
+	}
+	if err := events.Validate(eventType, version, data); err != nil {
+		return entity.OutboxEvent{}, err
+	}
+	var raw []byte
+	if db.rawPayloads && events.HasProto(eventType, version) {
+		if raw, err = events.ToProto(eventType, version, data); err != nil {
+			return entity.OutboxEvent{}, err
+		}
+		data = nil
+	}
+	headerData, err := json.Marshal(merged)
+	if err != nil {
+		return entity.OutboxEvent{}, err
+	}
+
+	now := time.Now().UTC()
+	options := outbox.Options{AvailableAt: now}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return entity.OutboxEvent{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		EventType:     eventType,
+		Payload:       datatypes.JSON(data),
+		PayloadRaw:    raw,
+		Headers:       datatypes.JSON(headerData),
+		CreatedAt:     now,
+		AvailableAt:   options.AvailableAt,
+	}, nil
+}
+
+func encodePayload(payload any) ([]byte, error) {
+	switch p := payload.(type) {
+	case nil:
+		return nil, errors.New("outbox: payload is required")
+	case json.RawMessage:
+		return p, nil
+	case datatypes.JSON:
+		return p, nil
+	case []byte:
+		if !json.Valid(p) {
+			return nil, errors.New("outbox: payload is not valid JSON")
+		}
+		return p, nil
+	default:
+		return json.Marshal(payload)
+	}
+}
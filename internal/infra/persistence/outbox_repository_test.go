@@ -0,0 +1,110 @@
+package persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pressly/goose/v3"
+)
+
+// testDB connects to TEST_DATABASE_DSN and applies the migrations. Tests
+// that need Postgres are skipped without it; each one works on its own
+// aggregates so they can share the database.
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+	db, err := New(context.Background(), Config{WriteDSN: dsn})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+	sqlDB, err := db.Conn.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	if err := goose.SetDialect("postgres"); err != nil {
+		t.Fatal(err)
+	}
+	goose.SetLogger(goose.NopLogger())
+	if err := goose.Up(sqlDB, "../../../migrations"); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestClaimByIDHonoursEarlierEventsOfTheAggregate(t *testing.T) {
+	db := testDB(t)
+	repo := NewOutboxRepository(db)
+	ctx := context.Background()
+	const maxAttempts = 3
+
+	tests := []struct {
+		name string
+		// prior is applied to the earlier event of the aggregate.
+		prior     string
+		claimable bool
+	}{
+		{name: "no earlier event", prior: "", claimable: true},
+		{name: "earlier event pending", prior: "SET attempts = 0", claimable: false},
+		{name: "earlier event locked", prior: "SET locked_at = NOW()", claimable: false},
+		{name: "earlier event processed", prior: "SET processed_at = NOW()", claimable: true},
+		{name: "earlier event cancelled", prior: "SET cancelled_at = NOW()", claimable: true},
+		{name: "earlier event scheduled for later", prior: "SET available_at = NOW() + INTERVAL '1 hour'", claimable: true},
+		{name: "earlier event out of attempts", prior: "SET attempts = 3", claimable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregateID := uuid.New()
+			now := time.Now().Add(-time.Minute)
+			insert := func(createdAt time.Time) uuid.UUID {
+				id := uuid.New()
+				err := db.Write(ctx).Exec(`INSERT INTO outbox_events (id, aggregate_type, aggregate_id, event_type, payload, created_at, available_at)
+VALUES (?, 'user', ?, 'user.updated', '{}', ?, ?)`, id, aggregateID, createdAt, createdAt).Error
+				if err != nil {
+					t.Fatalf("insert: %v", err)
+				}
+				return id
+			}
+			if tt.prior != "" {
+				prior := insert(now)
+				if err := db.Write(ctx).Exec(`UPDATE outbox_events `+tt.prior+` WHERE id = ?`, prior).Error; err != nil {
+					t.Fatalf("update prior: %v", err)
+				}
+			}
+			id := insert(now.Add(time.Second))
+
+			claimed, err := repo.ClaimByID(ctx, id, maxAttempts)
+			if err != nil {
+				t.Fatalf("claim: %v", err)
+			}
+			if claimed != tt.claimable {
+				t.Fatalf("claimed = %t, want %t", claimed, tt.claimable)
+			}
+		})
+	}
+}
+
+func TestClaimByIDStopsAtMaxAttempts(t *testing.T) {
+	db := testDB(t)
+	repo := NewOutboxRepository(db)
+	ctx := context.Background()
+
+	id := uuid.New()
+	err := db.Write(ctx).Exec(`INSERT INTO outbox_events (id, aggregate_type, aggregate_id, event_type, payload, attempts)
+VALUES (?, 'user', ?, 'user.created', '{}', 2)`, id, uuid.New()).Error
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if claimed, err := repo.ClaimByID(ctx, id, 2); err != nil || claimed {
+		t.Fatalf("claim = %t, %v; want false", claimed, err)
+	}
+	if claimed, err := repo.ClaimByID(ctx, id, 3); err != nil || !claimed {
+		t.Fatalf("claim = %t, %v; want true", claimed, err)
+	}
+}
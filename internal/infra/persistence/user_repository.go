@@ -2,35 +2,31 @@ package persistence
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"time"
 
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/entity"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/repository"
 	"github.com/daffahilmyf/go-impl-postgres-ha/internal/infra/pagination"
 	"github.com/google/uuid"
-	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct {
 	db *DB
 }
 
+var _ repository.UserRepository = (*UserRepository)(nil)
+
 func NewUserRepository(db *DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-func (r *UserRepository) Create(ctx context.Context, name, email string) (entity.User, error) {
-	var user entity.User
+// Create stores user and flushes the events it recorded, such as
+// events.UserCreatedV1, into the outbox in the same transaction.
+func (r *UserRepository) Create(ctx context.Context, user entity.User) (entity.User, error) {
 	err := r.db.WithTx(ctx, func(txCtx context.Context) error {
-		created, err := r.createUserWithOutbox(txCtx, name, email)
-		if err != nil {
-			return err
-		}
-		user = created
-		return nil
+		return r.db.Write(txCtx).Create(&user).Error
 	})
 	if err != nil {
 		return entity.User{}, err
@@ -38,11 +34,8 @@ func (r *UserRepository) Create(ctx context.Context, name, email string) (entity
 	return user, nil
 }
 
-func (r *UserRepository) CreateIdempotent(ctx context.Context, name, email, key, requestHash string) (entity.User, bool, error) {
-	var (
-		user         entity.User
-		alreadyExist bool
-	)
+func (r *UserRepository) CreateIdempotent(ctx context.Context, user entity.User, key, requestHash string) (entity.User, bool, error) {
+	var alreadyExist bool
 	err := r.db.WithTx(ctx, func(txCtx context.Context) error {
 		var existing entity.IdempotencyKey
 		if err := r.db.Write(txCtx).First(&existing, "key = ?", key).Error; err == nil {
@@ -60,7 +53,7 @@ func (r *UserRepository) CreateIdempotent(ctx context.Context, name, email, key,
 			return err
 		}
 
-		created, err := r.createUserWithOutbox(txCtx, name, email)
+		created, err := r.Create(txCtx, user)
 		if err != nil {
 			return err
 		}
@@ -98,42 +91,6 @@ func (r *UserRepository) CreateIdempotent(ctx context.Context, name, email, key,
 	return user, alreadyExist, nil
 }
 
-func (r *UserRepository) createUserWithOutbox(ctx context.Context, name, email string) (entity.User, error) {
-	user := entity.User{Name: name, Email: email}
-	if err := r.db.Write(ctx).Create(&user).Error; err != nil {
-		return entity.User{}, err
-	}
-
-	payload := struct {
-		ID        string    `json:"id"`
-		Name      string    `json:"name"`
-		Email     string    `json:"email"`
-		CreatedAt time.Time `json:"created_at"`
-	}{
-		ID:        user.ID.String(),
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-	}
-	data, err := json.Marshal(payload)
-	if err != nil {
-		return entity.User{}, err
-	}
-
-	outbox := entity.OutboxEvent{
-		AggregateType: "user",
-		AggregateID:   user.ID,
-		EventType:     "user.created",
-		Payload:       datatypes.JSON(data),
-		CreatedAt:     time.Now().UTC(),
-	}
-	if err := r.db.Write(ctx).Create(&outbox).Error; err != nil {
-		return entity.User{}, err
-	}
-
-	return user, nil
-}
-
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (entity.User, error) {
 	var user entity.User
 	if err := r.db.Read(ctx).First(&user, "id = ?", id).Error; err != nil {
@@ -142,18 +99,37 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (entity.User
 	return user, nil
 }
 
-func (r *UserRepository) Update(ctx context.Context, id uuid.UUID, name, email string) (entity.User, error) {
-	if err := r.db.Write(ctx).
-		Model(&entity.User{}).
-		Where("id = ?", id).
-		Updates(map[string]any{"name": name, "email": email}).Error; err != nil {
+// Update locks the user, applies mutate and saves the result together with
+// any events mutate recorded.
+func (r *UserRepository) Update(ctx context.Context, id uuid.UUID, mutate func(user *entity.User) error) (entity.User, error) {
+	var user entity.User
+	err := r.db.WithTx(ctx, func(txCtx context.Context) error {
+		if err := r.db.Write(txCtx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := mutate(&user); err != nil {
+			return err
+		}
+		return r.db.Write(txCtx).Save(&user).Error
+	})
+	if err != nil {
 		return entity.User{}, err
 	}
-	return r.GetByID(ctx, id)
+	return user, nil
 }
 
 func (r *UserRepository) DeleteByID(ctx context.Context, id uuid.UUID) error {
-	return r.db.Write(ctx).Delete(&entity.User{}, "id = ?", id).Error
+	return r.db.WithTx(ctx, func(txCtx context.Context) error {
+		var user entity.User
+		if err := r.db.Write(txCtx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		user.Delete()
+		return r.db.Write(txCtx).Delete(&user).Error
+	})
 }
 
 func (r *UserRepository) ListCursor(ctx context.Context, limit int, cursor string) ([]entity.User, error) {
@@ -0,0 +1,79 @@
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Shutdown splits a graceful stop into two phases. Stopping ends on the
+// first SIGINT or SIGTERM: loops stop fetching and claiming new work. Work
+// ends grace later, or on a second signal: in-flight work gives up and is
+// handed back (nak, lock release).
+type Shutdown struct {
+	stopping   context.Context
+	work       context.Context
+	stop       context.CancelFunc
+	cancelWork context.CancelFunc
+	signals    chan os.Signal
+	done       chan struct{}
+}
+
+func Listen(parent context.Context, grace time.Duration) *Shutdown {
+	stopping, stop := context.WithCancel(parent)
+	work, cancelWork := context.WithCancel(context.WithoutCancel(parent))
+	s := &Shutdown{
+		stopping:   stopping,
+		work:       work,
+		stop:       stop,
+		cancelWork: cancelWork,
+		signals:    make(chan os.Signal, 2),
+		done:       make(chan struct{}),
+	}
+	signal.Notify(s.signals, syscall.SIGINT, syscall.SIGTERM)
+	go s.watch(grace)
+	return s
+}
+
+func (s *Shutdown) watch(grace time.Duration) {
+	select {
+	case <-s.signals:
+	case <-s.stopping.Done():
+	case <-s.done:
+		return
+	}
+	s.stop()
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-s.signals:
+	case <-timer.C:
+	case <-s.done:
+	}
+	s.cancelWork()
+}
+
+// Stopping is cancelled once shutdown begins.
+func (s *Shutdown) Stopping() context.Context {
+	return s.stopping
+}
+
+// Work is cancelled when the grace period after Stopping runs out.
+func (s *Shutdown) Work() context.Context {
+	return s.work
+}
+
+// Stop begins shutdown as if a signal had arrived.
+func (s *Shutdown) Stop() {
+	s.stop()
+}
+
+// Close stops listening for signals and cancels both contexts.
+func (s *Shutdown) Close() {
+	signal.Stop(s.signals)
+	close(s.done)
+	s.stop()
+	s.cancelWork()
+}
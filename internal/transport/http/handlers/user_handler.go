@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	nethttp "net/http"
 	"strconv"
 
@@ -13,8 +14,9 @@ import (
 )
 
 type Handler struct {
-	user  service.UserService
-	store repository.Store
+	user   service.UserService
+	store  repository.Store
+	checks map[string]func(ctx context.Context) error
 }
 
 func NewHandler(user service.UserService, store repository.Store) *Handler {
@@ -126,10 +128,33 @@ func (h *Handler) listUsers(c *gin.Context) {
 	response.RespondOK(c, nethttp.StatusOK, users, meta)
 }
 
+// AddHealthCheck reports a dependency the API can run without. A failing
+// check marks /healthz degraded but keeps it 200; only the database takes
+// the service down.
+func (h *Handler) AddHealthCheck(name string, check func(ctx context.Context) error) {
+	if h.checks == nil {
+		h.checks = make(map[string]func(ctx context.Context) error)
+	}
+	h.checks[name] = check
+}
+
 func (h *Handler) health(c *gin.Context) {
 	if err := h.store.Ping(c.Request.Context()); err != nil {
 		response.RespondOK(c, nethttp.StatusServiceUnavailable, gin.H{"status": "down"}, nil)
 		return
 	}
-	response.RespondOK(c, nethttp.StatusOK, gin.H{"status": "ok"}, nil)
+	if len(h.checks) == 0 {
+		response.RespondOK(c, nethttp.StatusOK, gin.H{"status": "ok"}, nil)
+		return
+	}
+	status := "ok"
+	checks := make(gin.H, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = "ok"
+		if err := check(c.Request.Context()); err != nil {
+			checks[name] = err.Error()
+			status = "degraded"
+		}
+	}
+	response.RespondOK(c, nethttp.StatusOK, gin.H{"status": status, "checks": checks}, nil)
 }
@@ -18,14 +18,15 @@ func Logger(log *logrus.Logger) gin.HandlerFunc {
 			requestID = c.GetHeader("X-Request-ID")
 		}
 		entry := log.WithFields(logrus.Fields{
-			"status":     c.Writer.Status(),
-			"method":     c.Request.Method,
-			"path":       path,
-			"ip":         c.ClientIP(),
-			"latency":    time.Since(start).String(),
-			"error":      c.Errors.ByType(gin.ErrorTypePrivate).String(),
-			"user_agent": c.Request.UserAgent(),
-			"request_id": requestID,
+			"status":      c.Writer.Status(),
+			"method":      c.Request.Method,
+			"path":        path,
+			"ip":          c.ClientIP(),
+			"latency":     time.Since(start).String(),
+			"error":       c.Errors.ByType(gin.ErrorTypePrivate).String(),
+			"user_agent":  c.Request.UserAgent(),
+			"request_id":  requestID,
+			"traceparent": c.GetString(TraceParentKey),
 		})
 
 		if c.Writer.Status() >= 500 {
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/daffahilmyf/go-impl-postgres-ha/internal/domain/outbox"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	TraceParentKey  = "traceparent"
+	ClaimedActorKey = "claimed_actor"
+
+	// ActorHeader names the acting user. It is not authenticated and is
+	// passed on as X-Claimed-Actor.
+	ActorHeader = "X-Actor"
+)
+
+// Trace continues the caller's W3C trace (or starts one) and attaches the
+// request ID, traceparent and claimed actor to the request context, so outbox events
+// written while handling the request carry them as headers.
+func Trace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		traceParent := childTraceParent(c.GetHeader("traceparent"))
+		actor := c.GetHeader(ActorHeader)
+
+		requestID := c.GetString(RequestIDKey)
+		if requestID == "" {
+			requestID = c.GetHeader("X-Request-ID")
+		}
+
+		c.Set(TraceParentKey, traceParent)
+		c.Set(ClaimedActorKey, actor)
+		ctx := outbox.WithHeaders(c.Request.Context(), outbox.Headers{
+			outbox.HeaderRequestID:    requestID,
+			outbox.HeaderTraceParent:  traceParent,
+			outbox.HeaderClaimedActor: actor,
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// childTraceParent keeps the trace ID and flags of a valid incoming
+// traceparent and assigns a new span ID; otherwise it starts a new trace.
+func childTraceParent(incoming string) string {
+	parts := strings.Split(incoming, "-")
+	if len(parts) == 4 && parts[0] == "00" && isHex(parts[1], 32) && isHex(parts[2], 16) && isHex(parts[3], 2) &&
+		parts[1] != strings.Repeat("0", 32) {
+		return "00-" + parts[1] + "-" + randomHex(8) + "-" + parts[3]
+	}
+	return "00-" + randomHex(16) + "-" + randomHex(8) + "-01"
+}
+
+func isHex(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil && strings.ToLower(value) == value
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -23,16 +23,17 @@ func NewUser(repo repository.UserRepository, log *logrus.Logger) *User {
 }
 
 func (u *User) Create(ctx context.Context, name, email, idempotencyKey, requestHash string) (entity.User, bool, error) {
+	user := entity.NewUser(name, email)
 	if idempotencyKey == "" {
-		user, err := u.repo.Create(ctx, name, email)
+		created, err := u.repo.Create(ctx, user)
 		if err != nil {
 			u.log.WithError(err).Error("create user failed")
 			return entity.User{}, false, err
 		}
-		return user, false, nil
+		return created, false, nil
 	}
 
-	user, alreadyExist, err := u.repo.CreateIdempotent(ctx, name, email, idempotencyKey, requestHash)
+	user, alreadyExist, err := u.repo.CreateIdempotent(ctx, user, idempotencyKey, requestHash)
 	if err != nil {
 		u.log.WithError(err).Error("create user failed")
 		return entity.User{}, false, err
@@ -50,7 +51,10 @@ func (u *User) GetByID(ctx context.Context, id uuid.UUID) (entity.User, error) {
 }
 
 func (u *User) Update(ctx context.Context, id uuid.UUID, name, email string) (entity.User, error) {
-	user, err := u.repo.Update(ctx, id, name, email)
+	user, err := u.repo.Update(ctx, id, func(user *entity.User) error {
+		user.Update(name, email)
+		return nil
+	})
 	if err != nil {
 		u.log.WithError(err).Error("update user failed")
 		return entity.User{}, err
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS outbox_leases (
+    name TEXT PRIMARY KEY,
+    holder TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS outbox_workers (
+    worker_id TEXT PRIMARY KEY,
+    heartbeat_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_workers_heartbeat_at ON outbox_workers (heartbeat_at);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_aggregate_pending ON outbox_events (aggregate_id, created_at) WHERE processed_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_outbox_events_aggregate_pending;
+DROP TABLE IF EXISTS outbox_workers;
+DROP TABLE IF EXISTS outbox_leases;
@@ -0,0 +1,70 @@
+-- The copy below runs in this migration's transaction and holds an exclusive
+-- lock on outbox_events until it finishes. On large tables, delete processed
+-- rows in batches beforehand (see docs/nats.md, "Outbox Retention").
+
+-- +goose Up
+ALTER TABLE outbox_events RENAME TO outbox_events_unpartitioned;
+ALTER TABLE outbox_events_unpartitioned RENAME CONSTRAINT outbox_events_pkey TO outbox_events_unpartitioned_pkey;
+DROP INDEX IF EXISTS idx_outbox_events_unprocessed;
+DROP INDEX IF EXISTS idx_outbox_events_locked;
+DROP INDEX IF EXISTS idx_outbox_events_created_at;
+DROP INDEX IF EXISTS idx_outbox_events_aggregate_pending;
+
+CREATE TABLE outbox_events (
+    id UUID NOT NULL DEFAULT gen_random_uuid(),
+    aggregate_type TEXT NOT NULL,
+    aggregate_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_at TIMESTAMPTZ NULL,
+    processed_at TIMESTAMPTZ NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NULL,
+    PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+CREATE TABLE outbox_events_default PARTITION OF outbox_events DEFAULT;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unprocessed ON outbox_events (processed_at) WHERE processed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_locked ON outbox_events (locked_at) WHERE processed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_created_at ON outbox_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_aggregate_pending ON outbox_events (aggregate_id, created_at) WHERE processed_at IS NULL;
+
+INSERT INTO outbox_events (id, aggregate_type, aggregate_id, event_type, payload, created_at, locked_at, processed_at, attempts, last_error)
+SELECT id, aggregate_type, aggregate_id, event_type, payload, created_at, locked_at, processed_at, attempts, last_error
+FROM outbox_events_unpartitioned;
+
+DROP TABLE outbox_events_unpartitioned;
+
+-- +goose Down
+ALTER TABLE outbox_events RENAME TO outbox_events_partitioned;
+ALTER TABLE outbox_events_partitioned RENAME CONSTRAINT outbox_events_pkey TO outbox_events_partitioned_pkey;
+DROP INDEX IF EXISTS idx_outbox_events_unprocessed;
+DROP INDEX IF EXISTS idx_outbox_events_locked;
+DROP INDEX IF EXISTS idx_outbox_events_created_at;
+DROP INDEX IF EXISTS idx_outbox_events_aggregate_pending;
+
+CREATE TABLE outbox_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    aggregate_type TEXT NOT NULL,
+    aggregate_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_at TIMESTAMPTZ NULL,
+    processed_at TIMESTAMPTZ NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unprocessed ON outbox_events (processed_at) WHERE processed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_locked ON outbox_events (locked_at);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_created_at ON outbox_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_aggregate_pending ON outbox_events (aggregate_id, created_at) WHERE processed_at IS NULL;
+
+INSERT INTO outbox_events (id, aggregate_type, aggregate_id, event_type, payload, created_at, locked_at, processed_at, attempts, last_error)
+SELECT id, aggregate_type, aggregate_id, event_type, payload, created_at, locked_at, processed_at, attempts, last_error
+FROM outbox_events_partitioned;
+
+DROP TABLE outbox_events_partitioned;
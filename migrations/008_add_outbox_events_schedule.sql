@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS available_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ NULL;
+
+UPDATE outbox_events SET available_at = created_at WHERE processed_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_available_at ON outbox_events (available_at) WHERE processed_at IS NULL AND cancelled_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_outbox_events_available_at;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS cancelled_at;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS available_at;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS headers JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+-- +goose Down
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS headers;
@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS request_id TEXT NULL;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS traceparent TEXT NULL;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS actor TEXT NULL;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS headers JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_request_id ON audit_logs (request_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_audit_logs_request_id;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS headers;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS actor;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS traceparent;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS request_id;
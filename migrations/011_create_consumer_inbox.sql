@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS consumer_inbox (
+    consumer TEXT NOT NULL,
+    message_id TEXT NOT NULL,
+    stream TEXT NOT NULL,
+    sequence BIGINT NOT NULL,
+    subject TEXT NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (consumer, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_consumer_inbox_processed_at ON consumer_inbox (processed_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_consumer_inbox_processed_at;
+DROP TABLE IF EXISTS consumer_inbox;
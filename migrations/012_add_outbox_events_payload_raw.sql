@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS payload_raw BYTEA;
+ALTER TABLE outbox_events ALTER COLUMN payload DROP NOT NULL;
+ALTER TABLE outbox_events ADD CONSTRAINT outbox_events_payload_present CHECK (payload IS NOT NULL OR payload_raw IS NOT NULL);
+
+-- +goose Down
+-- Rows stored only as protobuf lose their payload on the way down.
+ALTER TABLE outbox_events DROP CONSTRAINT IF EXISTS outbox_events_payload_present;
+UPDATE outbox_events SET payload = '{}'::jsonb WHERE payload IS NULL;
+ALTER TABLE outbox_events ALTER COLUMN payload SET NOT NULL;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS payload_raw;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE audit_logs RENAME COLUMN actor TO claimed_actor;
+COMMENT ON COLUMN audit_logs.claimed_actor IS 'X-Actor header sent by the client; not authenticated';
+
+-- +goose Down
+COMMENT ON COLUMN audit_logs.claimed_actor IS NULL;
+ALTER TABLE audit_logs RENAME COLUMN claimed_actor TO actor;